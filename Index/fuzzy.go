@@ -0,0 +1,260 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Typo tolerance is edit distance (Damerau, so a swapped pair of letters is one
+// edit) against words and names held in memory. The vocabulary is rebuilt from
+// the database only after the index changes, keeping /suggest cheap enough to
+// call on every keystroke.
+
+// vocabulary is the in-memory copy of what the fuzzy matchers search
+type vocabulary struct {
+	words map[string]int // word in names and ingredients -> number of recipes using it
+	names []Summary
+}
+
+// maxEdits is how many typos a word of n letters may contain: none for very
+// short words, where one edit reaches almost anything
+func maxEdits(n int) int {
+	switch {
+	case n < 3:
+		return 0
+	case n < 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// words splits text into lower-cased runs of letters and digits
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// editDistance is the optimal string alignment distance between a and b,
+// stopping early once it must exceed max
+func editDistance(a, b []rune, max int) int {
+	if d := len(a) - len(b); d > max || -d > max {
+		return max + 1
+	}
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
+
+// correct returns the closest known word to word, preferring the commoner one
+// on ties, or "" if nothing is close enough
+func (v *vocabulary) correct(word string) string {
+	if _, ok := v.words[word]; ok {
+		return word
+	}
+	w := []rune(word)
+	allowed := maxEdits(len(w))
+	best, bestDist, bestCount := "", allowed+1, 0
+	for candidate, count := range v.words {
+		d := editDistance(w, []rune(candidate), allowed)
+		if d > allowed {
+			continue
+		}
+		if d < bestDist || d == bestDist && (count > bestCount || count == bestCount && candidate < best) {
+			best, bestDist, bestCount = candidate, d, count
+		}
+	}
+	return best
+}
+
+// didYouMean rewrites q with each unknown word replaced by its closest known
+// word. It returns "" when there is nothing to correct. Phrases are left alone.
+func (v *vocabulary) didYouMean(q string) string {
+	if strings.Contains(q, `"`) {
+		return ""
+	}
+	fields := strings.Fields(strings.ToLower(q))
+	changed := false
+	for i, field := range fields {
+		ws := words(field)
+		if len(ws) != 1 {
+			continue
+		}
+		if fixed := v.correct(ws[0]); fixed != "" && fixed != ws[0] {
+			fields[i] = fixed
+			changed = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return strings.Join(fields, " ")
+}
+
+// SuggestNames returns up to limit recipe names that start, or have a word
+// starting, with prefix, allowing for typos. Exact prefix matches come first,
+// then closer matches, then those agreeing on more leading letters, then
+// matches at the start of the name.
+func SuggestNames(names []Summary, prefix string, limit int) []Summary {
+	p := []rune(strings.Join(words(prefix), " "))
+	if len(p) == 0 {
+		return []Summary{}
+	}
+	// A prefix is judged as if a letter shorter: three typed letters must match exactly
+	allowed := maxEdits(len(p) - 1)
+
+	type match struct {
+		Summary
+		dist, common, offset int
+	}
+	var matches []match
+	for _, s := range names {
+		name := []rune(strings.Join(words(s.Name), " "))
+		best := match{Summary: s, dist: allowed + 1}
+		for start := 0; start < len(name); start++ {
+			if start > 0 && name[start-1] != ' ' {
+				continue // only compare from the start of a word
+			}
+			// A typo can make the typed prefix shorter or longer than the name's
+			for n := len(p) - allowed; n <= len(p)+allowed; n++ {
+				if n < 1 || start+n > len(name) {
+					continue
+				}
+				d := editDistance(p, name[start:start+n], allowed)
+				common := commonPrefix(p, name[start:])
+				if d < best.dist || d == best.dist && common > best.common {
+					best.dist, best.common, best.offset = d, common, start
+				}
+			}
+		}
+		if best.dist <= allowed {
+			matches = append(matches, best)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.dist != b.dist {
+			return a.dist < b.dist
+		}
+		if a.common != b.common {
+			return a.common > b.common
+		}
+		if (a.offset == 0) != (b.offset == 0) {
+			return a.offset == 0
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+
+	suggestions := []Summary{}
+	for i := 0; i < len(matches) && i < limit; i++ {
+		suggestions = append(suggestions, matches[i].Summary)
+	}
+	return suggestions
+}
+
+// Summaries reduces list rows to IDs and names
+func Summaries(recipes []RecipeInfo) []Summary {
+	summaries := make([]Summary, len(recipes))
+	for i, r := range recipes {
+		summaries[i] = Summary{ID: r.ID, Name: r.Name}
+	}
+	return summaries
+}
+
+// commonPrefix is how many leading runes a and b share
+func commonPrefix(a, b []rune) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// loadVocabulary returns the cached vocabulary, rebuilding it if the index changed since
+func (idx *Index) loadVocabulary() (*vocabulary, error) {
+	idx.vocabMu.Lock()
+	defer idx.vocabMu.Unlock()
+	gen := idx.generation.Load()
+	if idx.vocab != nil && idx.vocabGen == gen {
+		return idx.vocab, nil
+	}
+
+	v := &vocabulary{words: make(map[string]int)}
+	recipes, err := idx.List(Filter{})
+	if err != nil {
+		return nil, err
+	}
+	v.names = Summaries(recipes)
+
+	rows, err := idx.db.Query(`SELECT r.id, r.name, COALESCE(group_concat(i.text, ' '), '')
+		FROM recipes r LEFT JOIN ingredients i ON i.recipe_id = r.id GROUP BY r.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, name, ingredients string
+		if err := rows.Scan(&id, &name, &ingredients); err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, w := range words(name + " " + ingredients) {
+			// Numbers and single letters are never worth suggesting
+			if !seen[w] && len([]rune(w)) > 1 && !unicode.IsDigit([]rune(w)[0]) {
+				seen[w] = true
+				v.words[w]++
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	idx.vocab, idx.vocabGen = v, gen
+	return v, nil
+}
+
+// DidYouMean returns q with misspelt words corrected against the recipe names
+// and ingredients, or "" if every word is already known or nothing is close
+func (idx *Index) DidYouMean(q string) (string, error) {
+	v, err := idx.loadVocabulary()
+	if err != nil {
+		return "", err
+	}
+	return v.didYouMean(q), nil
+}
+
+// Suggest returns up to limit recipe names for an autocomplete prefix
+func (idx *Index) Suggest(prefix string, limit int) ([]Summary, error) {
+	v, err := idx.loadVocabulary()
+	if err != nil {
+		return nil, err
+	}
+	return SuggestNames(v.names, prefix, limit), nil
+}
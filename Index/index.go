@@ -0,0 +1,512 @@
+package index
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	rfp "github.com/CaptSniper/RecipeServer/RFP"
+	_ "modernc.org/sqlite" // pure Go driver, no cgo
+)
+
+// The index is an embedded SQLite database mirroring recipe metadata,
+// ingredients, tags and full text so list queries don't decode every .rfp.
+// The .rfp files stay the source of truth: Sync compares each file's size and
+// mtime with what was indexed and re-reads only what changed, and the whole
+// database can be thrown away and rebuilt at any time.
+
+// schemaVersion is stored in PRAGMA user_version; a mismatch rebuilds the index
+const schemaVersion = 5 // 5: time properties are read whatever their case
+
+const schema = `
+CREATE TABLE recipes (
+	id          TEXT PRIMARY KEY,
+	name        TEXT NOT NULL,
+	image_path  TEXT NOT NULL,
+	servings    TEXT NOT NULL,
+	prep_time   TEXT NOT NULL,
+	cook_time   TEXT NOT NULL,
+	total_time  TEXT NOT NULL,
+	prep_minutes  INTEGER,
+	cook_minutes  INTEGER,
+	total_minutes INTEGER,
+	created_at  INTEGER NOT NULL,
+	file_size   INTEGER NOT NULL,
+	file_mtime  INTEGER NOT NULL,
+	indexed_at  INTEGER NOT NULL
+);
+CREATE TABLE ingredients (
+	recipe_id TEXT NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+	position  INTEGER NOT NULL,
+	text      TEXT NOT NULL
+);
+CREATE INDEX ingredients_recipe ON ingredients(recipe_id);
+CREATE TABLE tags (
+	recipe_id TEXT NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+	tag       TEXT NOT NULL
+);
+CREATE INDEX tags_tag ON tags(tag);
+CREATE VIRTUAL TABLE recipes_fts USING fts5(id UNINDEXED, name, ingredients, steps, props, tokenize='porter unicode61');
+`
+
+// Index is a handle on the SQLite index for one recipe directory
+type Index struct {
+	db        *sql.DB
+	recipeDir string
+	mu        sync.Mutex // serialises Sync so concurrent requests don't index the same file twice
+
+	generation atomic.Uint64 // bumped on every change, invalidating vocab
+	vocabMu    sync.Mutex
+	vocab      *vocabulary
+	vocabGen   uint64
+}
+
+// Filter narrows a list query. Empty fields match everything.
+type Filter struct {
+	Query      string // full text over name, ingredients, steps and properties
+	Ingredient string // substring of any ingredient line
+	Tag        string // exact tag, case-insensitive
+
+	MaxTotalMinutes *int // total time at most this long; recipes without one don't match
+}
+
+// Summary identifies a recipe by ID and name
+type Summary struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// RecipeInfo is one recipe row returned by List. Created is when the recipe
+// was first seen, Updated when its file last changed. The Minutes fields are
+// the times read by rfp.ParseDuration, nil when missing or unreadable.
+type RecipeInfo struct {
+	ID           string
+	Name         string
+	ImagePath    string
+	Servings     string
+	PrepTime     string
+	CookTime     string
+	TotalTime    string
+	PrepMinutes  *int
+	CookMinutes  *int
+	TotalMinutes *int
+	Created      time.Time
+	Updated      time.Time
+}
+
+// NewRecipeInfo describes a decoded recipe without an index, taking both
+// Created and Updated from the file's modification time
+func NewRecipeInfo(id string, r *rfp.Recipe, info os.FileInfo) RecipeInfo {
+	times := r.Times()
+	return RecipeInfo{
+		ID:           id,
+		Name:         r.Name,
+		ImagePath:    r.ImagePath,
+		Servings:     r.Prop("servings"),
+		PrepTime:     r.Prop("prep time"),
+		CookTime:     r.Prop("cook time"),
+		TotalTime:    r.Prop("total time"),
+		PrepMinutes:  minutes(times.Prep),
+		CookMinutes:  minutes(times.Cook),
+		TotalMinutes: minutes(times.Total),
+		Created:      info.ModTime(),
+		Updated:      info.ModTime(),
+	}
+}
+
+// Open opens the index for the recipes in cfg.DefaultRecipePath, creating the database if needed
+func Open(cfg *rfp.Config) (*Index, error) {
+	path := IndexPath(cfg)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	idx := &Index{db: db, recipeDir: cfg.DefaultRecipePath}
+	if err := idx.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+// IndexPath returns the configured database path, defaulting to .config/recipes.db
+func IndexPath(cfg *rfp.Config) string {
+	if cfg.IndexPath == "" {
+		return filepath.Join(".config", "recipes.db")
+	}
+	return cfg.IndexPath
+}
+
+func (idx *Index) Close() error {
+	return idx.db.Close()
+}
+
+// migrate creates the schema, dropping an index built by a different schema version
+func (idx *Index) migrate() error {
+	var version int
+	if err := idx.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version == schemaVersion {
+		return nil
+	}
+	return idx.reset()
+}
+
+// reset drops everything and recreates an empty schema
+func (idx *Index) reset() error {
+	tx, err := idx.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"recipes_fts", "tags", "ingredients", "recipes"} {
+		if _, err := tx.Exec("DROP TABLE IF EXISTS " + table); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(schema); err != nil {
+		return fmt.Errorf("failed to create index schema: %v", err)
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion)); err != nil {
+		return err
+	}
+	defer idx.generation.Add(1)
+	return tx.Commit()
+}
+
+// Rebuild discards the index and re-reads every recipe file
+func (idx *Index) Rebuild() (int, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.reset(); err != nil {
+		return 0, err
+	}
+	return idx.sync()
+}
+
+// Refresh re-indexes just the given recipes, removing any whose file is gone.
+// Writers call it so the index doesn't wait for the next Sync.
+func (idx *Index) Refresh(ids ...string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, id := range ids {
+		filename := id + ".rfp"
+		info, err := os.Stat(filepath.Join(idx.recipeDir, filename))
+		if os.IsNotExist(err) {
+			if err := idx.remove(id); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		recipe, err := rfp.ReadRecipeFile(idx.recipeDir, filename)
+		if err != nil {
+			idx.remove(id)
+			continue
+		}
+		if err := idx.upsert(id, recipe, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync brings the index up to date with the recipe directory and returns how
+// many recipes were added, updated or removed. Unchanged files are only stat'ed.
+func (idx *Index) Sync() (int, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.sync()
+}
+
+func (idx *Index) sync() (int, error) {
+	type fileState struct{ size, mtime int64 }
+	indexed := make(map[string]fileState)
+	rows, err := idx.db.Query("SELECT id, file_size, file_mtime FROM recipes")
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var id string
+		var st fileState
+		if err := rows.Scan(&id, &st.size, &st.mtime); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		indexed[id] = st
+	}
+	rows.Close()
+
+	files, err := os.ReadDir(idx.recipeDir)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, file := range files {
+		if filepath.Ext(file.Name()) != ".rfp" {
+			continue
+		}
+		id := strings.TrimSuffix(file.Name(), ".rfp")
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		st, ok := indexed[id]
+		delete(indexed, id)
+		if ok && st.size == info.Size() && st.mtime == info.ModTime().UnixNano() {
+			continue
+		}
+
+		recipe, err := rfp.ReadRecipeFile(idx.recipeDir, file.Name())
+		if err != nil {
+			// Skip corrupted files, as listing does, and drop any stale entry
+			if ok {
+				idx.remove(id)
+			}
+			continue
+		}
+		if err := idx.upsert(id, recipe, info); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+
+	// Whatever is left was indexed but no longer exists on disk
+	for id := range indexed {
+		if err := idx.remove(id); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+func (idx *Index) upsert(id string, r *rfp.Recipe, info os.FileInfo) error {
+	tx, err := idx.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Keep the creation time across updates; a recipe new to the index is
+	// dated by its file, which is the best guess for one written before indexing
+	created := info.ModTime().UnixNano()
+	if err := tx.QueryRow("SELECT created_at FROM recipes WHERE id = ?", id).Scan(&created); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if err := deleteRecipe(tx, id); err != nil {
+		return err
+	}
+	times := r.Times()
+	_, err = tx.Exec(`INSERT INTO recipes (id, name, image_path, servings, prep_time, cook_time, total_time, prep_minutes, cook_minutes, total_minutes,
+		created_at, file_size, file_mtime, indexed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, r.Name, r.ImagePath, r.Prop("servings"), r.Prop("prep time"), r.Prop("cook time"), r.Prop("total time"),
+		minutes(times.Prep), minutes(times.Cook), minutes(times.Total), created, info.Size(), info.ModTime().UnixNano(), time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	for i, ing := range r.Ingredients {
+		if _, err := tx.Exec("INSERT INTO ingredients (recipe_id, position, text) VALUES (?, ?, ?)", id, i, ing); err != nil {
+			return err
+		}
+	}
+	for _, tag := range Tags(r) {
+		if _, err := tx.Exec("INSERT INTO tags (recipe_id, tag) VALUES (?, ?)", id, tag); err != nil {
+			return err
+		}
+	}
+
+	props := make([]string, 0, len(r.CoreProps))
+	for k, v := range r.CoreProps {
+		props = append(props, k+": "+v)
+	}
+	_, err = tx.Exec("INSERT INTO recipes_fts (id, name, ingredients, steps, props) VALUES (?, ?, ?, ?, ?)",
+		id, r.Name, strings.Join(r.Ingredients, "\n"), strings.Join(r.Steps, "\n"), strings.Join(props, "\n"))
+	if err != nil {
+		return err
+	}
+	defer idx.generation.Add(1)
+	return tx.Commit()
+}
+
+func (idx *Index) remove(id string) error {
+	tx, err := idx.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := deleteRecipe(tx, id); err != nil {
+		return err
+	}
+	defer idx.generation.Add(1)
+	return tx.Commit()
+}
+
+func deleteRecipe(tx *sql.Tx, id string) error {
+	// fts5 tables don't take part in foreign keys, so clear them by hand
+	if _, err := tx.Exec("DELETE FROM recipes_fts WHERE id = ?", id); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM recipes WHERE id = ?", id)
+	return err
+}
+
+// List returns the recipes matching f, ordered by name
+func (idx *Index) List(f Filter) ([]RecipeInfo, error) {
+	query := `SELECT r.id, r.name, r.image_path, r.servings, r.prep_time, r.cook_time, r.total_time,
+		r.prep_minutes, r.cook_minutes, r.total_minutes, r.created_at, r.file_mtime FROM recipes r WHERE 1=1`
+	var args []any
+	if match := ftsQuery(f.Query); match != "" {
+		query += " AND r.id IN (SELECT id FROM recipes_fts WHERE recipes_fts MATCH ?)"
+		args = append(args, match)
+	}
+	if f.Ingredient != "" {
+		query += " AND r.id IN (SELECT recipe_id FROM ingredients WHERE text LIKE ? ESCAPE '\\')"
+		args = append(args, "%"+escapeLike(f.Ingredient)+"%")
+	}
+	if f.Tag != "" {
+		query += " AND r.id IN (SELECT recipe_id FROM tags WHERE tag = ?)"
+		args = append(args, strings.ToLower(f.Tag))
+	}
+	if f.MaxTotalMinutes != nil {
+		query += " AND r.total_minutes <= ?"
+		args = append(args, *f.MaxTotalMinutes)
+	}
+	query += " ORDER BY r.name COLLATE NOCASE"
+
+	rows, err := idx.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipes := []RecipeInfo{}
+	for rows.Next() {
+		var info RecipeInfo
+		var created, updated int64
+		if err := rows.Scan(&info.ID, &info.Name, &info.ImagePath, &info.Servings, &info.PrepTime, &info.CookTime,
+			&info.TotalTime, &info.PrepMinutes, &info.CookMinutes, &info.TotalMinutes, &created, &updated); err != nil {
+			return nil, err
+		}
+		info.Created, info.Updated = time.Unix(0, created), time.Unix(0, updated)
+		recipes = append(recipes, info)
+	}
+	return recipes, rows.Err()
+}
+
+// Tags returns a recipe's tags: the comma separated "tags" core property, lower-cased
+func Tags(r *rfp.Recipe) []string {
+	tags := []string{}
+	for key, value := range r.CoreProps {
+		if !strings.EqualFold(key, "tags") {
+			continue
+		}
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// Matches applies the filter to a decoded recipe. It is the fallback used
+// when the index is disabled, and mirrors what List does in SQL.
+func (f Filter) Matches(r *rfp.Recipe) bool {
+	if f.Ingredient != "" {
+		found := false
+		for _, ing := range r.Ingredients {
+			if strings.Contains(strings.ToLower(ing), strings.ToLower(f.Ingredient)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Tag != "" {
+		found := false
+		for _, tag := range Tags(r) {
+			if tag == strings.ToLower(f.Tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Query != "" {
+		text := strings.ToLower(r.Name + "\n" + strings.Join(r.Ingredients, "\n") + "\n" + strings.Join(r.Steps, "\n"))
+		for k, v := range r.CoreProps {
+			text += "\n" + strings.ToLower(k+": "+v)
+		}
+		for _, word := range strings.Fields(strings.ToLower(f.Query)) {
+			word = strings.Trim(word, `"`)
+			if hasToken(word) && !strings.Contains(text, word) {
+				return false
+			}
+		}
+	}
+	if f.MaxTotalMinutes != nil {
+		total := minutes(r.Times().Total)
+		if total == nil || *total > *f.MaxTotalMinutes {
+			return false
+		}
+	}
+	return true
+}
+
+// ftsQuery turns free text into an FTS5 query requiring every word. Text in
+// double quotes is kept together as a phrase. Each term is quoted so user input
+// can't inject FTS syntax, and a trailing bare word matches as a prefix. Terms
+// without a letter or digit would tokenise to nothing and are dropped, so text
+// of only quotes or punctuation gives "", meaning no full text filter.
+func ftsQuery(q string) string {
+	var terms []string
+	prefix := false
+	for i, part := range strings.Split(q, `"`) {
+		if i%2 == 1 {
+			// Inside quotes: a phrase
+			if phrase := strings.Join(strings.Fields(part), " "); hasToken(phrase) {
+				terms = append(terms, `"`+phrase+`"`)
+				prefix = false
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			if hasToken(word) {
+				terms = append(terms, `"`+word+`"`)
+				prefix = true
+			}
+		}
+	}
+	if prefix && !strings.HasSuffix(strings.TrimSpace(q), `"`) {
+		terms[len(terms)-1] += "*"
+	}
+	return strings.Join(terms, " ")
+}
+
+// hasToken reports whether the FTS tokenizer would find a word in s
+func hasToken(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
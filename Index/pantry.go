@@ -0,0 +1,313 @@
+package index
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	rfp "github.com/CaptSniper/RecipeServer/RFP"
+)
+
+// "What can I make?" compares ingredient names rather than whole lines:
+// "2 cups finely chopped fresh tomatoes (about 3)" and "tomato" are both
+// "tomato". Staples everyone has are left out of the count entirely.
+
+// RecipeIngredients is a recipe's ingredient lines as stored in the index
+type RecipeIngredients struct {
+	Summary
+	Ingredients []string
+}
+
+// Coverage is how much of one recipe the given ingredients cover. Matched and
+// Missing hold the recipe's original ingredient lines; staples are in neither.
+type Coverage struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Have     int      `json:"have"`
+	Total    int      `json:"total"`
+	Coverage float64  `json:"coverage"`
+	Matched  []string `json:"matched"`
+	Missing  []string `json:"missing"`
+}
+
+// staples are assumed to be in every kitchen
+var staples = map[string]bool{
+	"salt": true, "pepper": true, "black pepper": true, "salt and pepper": true,
+	"sea salt": true, "kosher salt": true, "table salt": true,
+	"water": true, "ice": true, "ice cube": true,
+	"oil": true, "vegetable oil": true, "cooking oil": true, "cooking spray": true,
+}
+
+// units are dropped wherever they appear before the ingredient name
+var units = map[string]bool{
+	"cup": true, "tablespoon": true, "tbsp": true, "tbs": true, "tb": true, "teaspoon": true, "tsp": true,
+	"ounce": true, "oz": true, "pound": true, "lb": true, "gram": true, "g": true, "kilogram": true, "kg": true,
+	"milliliter": true, "millilitre": true, "ml": true, "liter": true, "litre": true, "l": true,
+	"pint": true, "quart": true, "gallon": true, "pinch": true, "dash": true, "splash": true,
+	"can": true, "jar": true, "package": true, "pkg": true, "packet": true, "bag": true, "box": true, "bottle": true,
+	"stick": true, "slice": true, "piece": true, "bunch": true, "handful": true, "sprig": true,
+	"fillet": true, "sheet": true, "container": true, "of": true,
+}
+
+// countNouns are units when another word follows ("2 cloves garlic") and the
+// ingredient itself when nothing does ("6 whole cloves")
+var countNouns = map[string]bool{
+	"clove": true, "head": true, "stalk": true, "ear": true,
+}
+
+// descriptors say how an ingredient is prepared or bought, not what it is
+var descriptors = map[string]bool{
+	"chopped": true, "diced": true, "minced": true, "sliced": true, "grated": true, "shredded": true,
+	"crushed": true, "cubed": true, "halved": true, "quartered": true, "julienned": true, "mashed": true,
+	"peeled": true, "seeded": true, "pitted": true, "trimmed": true, "rinsed": true, "drained": true,
+	"beaten": true, "melted": true, "softened": true, "cooled": true, "toasted": true, "roasted": true,
+	"cooked": true, "uncooked": true, "raw": true, "fresh": true, "freshly": true, "frozen": true, "thawed": true,
+	"dried": true, "dry": true, "ground": true, "whole": true, "large": true, "medium": true, "small": true,
+	"extra": true, "virgin": true, "finely": true, "roughly": true, "coarsely": true, "thinly": true, "thickly": true,
+	"lightly": true, "packed": true, "heaping": true, "level": true, "boneless": true, "skinless": true,
+	"lean": true, "organic": true, "plain": true, "unsalted": true, "salted": true, "ripe": true,
+	"optional": true, "about": true, "approximately": true, "additional": true, "more": true, "good": true,
+	"quality": true, "all": true, "purpose": true, "room": true, "temperature": true, "cold": true, "warm": true, "hot": true, "a": true, "an": true,
+}
+
+// Words ending in s that are already singular
+var singularS = map[string]bool{
+	"molasses": true, "hummus": true, "couscous": true, "asparagus": true, "swiss": true,
+	"citrus": true, "octopus": true, "bass": true, "grass": true, "glass": true, "series": true,
+	"species": true,
+}
+
+// IngredientName reduces an ingredient line to the ingredient itself:
+// lower case, singular, with quantities, units, preparation words, notes in
+// parentheses and trailing notes removed. It returns "" for section headings
+// and lines that are only a quantity or preparation words.
+func IngredientName(line string) string {
+	line = strings.TrimSpace(line)
+	if strings.HasSuffix(line, ":") {
+		return "" // a section heading such as "For the sauce:"
+	}
+	// The parser takes off the amount, parentheses and notes after the comma,
+	// but notes can also be descriptors ("boneless, skinless chicken"), so
+	// fall back to them when the name itself is only descriptors
+	ing := rfp.ParseIngredient(line)
+	text := strings.ToLower(ing.Name)
+	if ing.Notes != "" {
+		text += ", " + strings.ToLower(ing.Notes)
+	}
+	for _, part := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ';' || r == ':' }) {
+		// Alternatives and trailing notes: "butter or margarine", "oil for frying"
+		part = " " + part
+		for _, cut := range []string{" or ", " for ", " to taste", " as needed", " divided"} {
+			if i := strings.Index(part, cut); i >= 0 {
+				part = part[:i]
+			}
+		}
+		if name := ingredientWords(part); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// ingredientWords drops quantities, units and descriptors from a fragment of an
+// ingredient line and singularises what is left
+func ingredientWords(text string) string {
+	var kept []string
+	countNoun := ""
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return unicode.IsSpace(r) || r == '-' }) {
+		word = strings.Trim(word, ".*!?\"'")
+		if word == "" || isQuantity(word) {
+			continue
+		}
+		word = singular(word)
+		if countNouns[word] {
+			countNoun = word
+			continue
+		}
+		if units[word] || descriptors[word] {
+			continue
+		}
+		kept = append(kept, word)
+	}
+	// "whole cloves" is the spice, "2 cloves garlic" is garlic
+	if len(kept) == 0 && countNoun != "" {
+		return countNoun
+	}
+	return strings.Join(kept, " ")
+}
+
+// isQuantity reports whether word is a number, fraction or range such as
+// "2", "1/2", "½", "1-2" or "1½"
+func isQuantity(word string) bool {
+	hasDigit := false
+	for _, r := range word {
+		switch {
+		case unicode.IsDigit(r) || unicode.Is(unicode.No, r):
+			hasDigit = true
+		case r == '/' || r == '.' || r == '-' || r == '–' || r == 'x':
+		default:
+			return false
+		}
+	}
+	return hasDigit
+}
+
+// singular strips common English plural endings
+func singular(word string) string {
+	if singularS[word] {
+		return word
+	}
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y" // berries
+	case len(word) > 4 && strings.HasSuffix(word, "oes"):
+		return word[:len(word)-2] // tomatoes
+	case len(word) > 4 && (strings.HasSuffix(word, "ches") || strings.HasSuffix(word, "shes") ||
+		strings.HasSuffix(word, "sses") || strings.HasSuffix(word, "xes")):
+		return word[:len(word)-2] // peaches, radishes, boxes
+	case len(word) > 3 && strings.HasSuffix(word, "s") &&
+		!strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is"):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// IsStaple reports whether a normalised ingredient name is a pantry staple
+func IsStaple(name string) bool {
+	return staples[name]
+}
+
+// cuts name a part of the ingredient before them, so a pantry item without
+// one still covers it: "chicken" covers "chicken thigh"
+var cuts = map[string]bool{
+	"breast": true, "thigh": true, "drumstick": true, "wing": true, "leg": true,
+	"loin": true, "tenderloin": true, "chop": true, "cutlet": true, "steak": true,
+	"shoulder": true, "rib": true, "shank": true, "belly": true, "brisket": true,
+	"mince": true, "strip": true, "tender": true,
+}
+
+// covers reports whether the ingredient we have satisfies the one needed.
+// Either the pantry item has every word of the needed one, so "cheddar cheese"
+// covers "cheese" and "olive oil" covers "oil", or the needed one is the pantry
+// item plus cuts, so "chicken" covers "chicken breast" but not "chicken broth".
+func covers(have, need []string) bool {
+	if subset(need, have) {
+		return true
+	}
+	if !subset(have, need) {
+		return false
+	}
+	for _, w := range need {
+		if !slices.Contains(have, w) && !cuts[w] {
+			return false
+		}
+	}
+	return true
+}
+
+func subset(a, b []string) bool {
+	if len(a) == 0 {
+		return false
+	}
+	for _, w := range a {
+		found := false
+		for _, x := range b {
+			if w == x {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// RankByCoverage scores every recipe by how many of its non-staple ingredients
+// are covered by have, dropping recipes with no match. The best covered recipes
+// come first, then those missing the fewest ingredients.
+func RankByCoverage(recipes []RecipeIngredients, have []string) []Coverage {
+	var haveNames [][]string
+	for _, h := range have {
+		if name := IngredientName(h); name != "" {
+			haveNames = append(haveNames, strings.Fields(name))
+		}
+	}
+
+	ranked := []Coverage{}
+	for _, r := range recipes {
+		c := Coverage{ID: r.ID, Name: r.Name, Matched: []string{}, Missing: []string{}}
+		for _, line := range r.Ingredients {
+			name := IngredientName(line)
+			if name == "" || IsStaple(name) {
+				continue
+			}
+			need := strings.Fields(name)
+			matched := false
+			for _, h := range haveNames {
+				if covers(h, need) {
+					matched = true
+					break
+				}
+			}
+			if matched {
+				c.Matched = append(c.Matched, line)
+			} else {
+				c.Missing = append(c.Missing, line)
+			}
+		}
+		c.Have, c.Total = len(c.Matched), len(c.Matched)+len(c.Missing)
+		if c.Have == 0 {
+			continue
+		}
+		c.Coverage = float64(c.Have) / float64(c.Total)
+		ranked = append(ranked, c)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.Coverage != b.Coverage {
+			return a.Coverage > b.Coverage
+		}
+		if len(a.Missing) != len(b.Missing) {
+			return len(a.Missing) < len(b.Missing)
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+	return ranked
+}
+
+// RecipeIngredientsOf pairs a decoded recipe with its ID, for callers without an index
+func RecipeIngredientsOf(id string, r *rfp.Recipe) RecipeIngredients {
+	return RecipeIngredients{Summary: Summary{ID: id, Name: r.Name}, Ingredients: r.Ingredients}
+}
+
+// AllIngredients returns every indexed recipe with its ingredient lines in order
+func (idx *Index) AllIngredients() ([]RecipeIngredients, error) {
+	rows, err := idx.db.Query(`SELECT r.id, r.name, i.text FROM recipes r
+		LEFT JOIN ingredients i ON i.recipe_id = r.id
+		ORDER BY r.name COLLATE NOCASE, r.id, i.position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipes := []RecipeIngredients{}
+	for rows.Next() {
+		var id, name string
+		var text *string
+		if err := rows.Scan(&id, &name, &text); err != nil {
+			return nil, err
+		}
+		if len(recipes) == 0 || recipes[len(recipes)-1].ID != id {
+			recipes = append(recipes, RecipeIngredients{Summary: Summary{ID: id, Name: name}})
+		}
+		if text != nil {
+			last := &recipes[len(recipes)-1]
+			last.Ingredients = append(last.Ingredients, *text)
+		}
+	}
+	return recipes, rows.Err()
+}
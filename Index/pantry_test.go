@@ -0,0 +1,42 @@
+package index
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		have, need string
+		want       bool
+	}{
+		// The same ingredient, however it is written
+		{"tomatoes", "2 cups chopped fresh tomatoes", true},
+		{"garlic", "3 cloves garlic, minced", true},
+
+		// A more specific pantry item covers the generic one
+		{"cheddar cheese", "1 cup shredded cheese", true},
+		{"olive oil", "2 tbsp oil", true},
+		{"cheese", "1 cup cheddar cheese", false},
+
+		// A generic pantry item covers cuts of it
+		{"chicken", "2 boneless, skinless chicken breasts", true},
+		{"chicken", "6 chicken thighs", true},
+		{"pork", "4 pork chops", true},
+		{"chicken breast", "1 lb chicken", true},
+		{"chicken breast", "6 chicken thighs", false},
+
+		// But not what is made from it
+		{"chicken", "2 cups chicken broth", false},
+		{"beef", "1 cup beef stock", false},
+		{"egg", "1 lb egg noodles", false},
+	}
+
+	for _, tt := range tests {
+		have := strings.Fields(IngredientName(tt.have))
+		need := strings.Fields(IngredientName(tt.need))
+		if got := covers(have, need); got != tt.want {
+			t.Errorf("covers(%q, %q) = %v, want %v", have, need, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package index
+
+import (
+	"html"
+	"strings"
+)
+
+// Search ranks recipes with FTS5's bm25. Words are stemmed by the porter
+// tokenizer, so "baking" finds "baked", and a hit in the name counts for
+// far more than one in the ingredients, steps or properties.
+
+// Column weights for bm25, in table order: id, name, ingredients, steps, props
+const rankWeights = "0.0, 10.0, 4.0, 1.0, 2.0"
+
+// Markers placed around matches by SQLite; swapped for <mark> after escaping
+const (
+	markOpen  = "\x02"
+	markClose = "\x03"
+)
+
+// SearchResult is one ranked hit. Highlights maps a field (name, ingredients,
+// steps, props) to an HTML-escaped excerpt with matches wrapped in <mark>.
+type SearchResult struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// Search returns up to limit recipes matching q, best first. Double quotes
+// make a phrase; every other word must appear somewhere in the recipe.
+func (idx *Index) Search(q string, limit int) ([]SearchResult, error) {
+	match := ftsQuery(q)
+	if match == "" {
+		return []SearchResult{}, nil
+	}
+	rows, err := idx.db.Query(`SELECT r.id, r.name, -bm25(recipes_fts, `+rankWeights+`),
+			highlight(recipes_fts, 1, ?, ?),
+			snippet(recipes_fts, 2, ?, ?, '…', 12),
+			snippet(recipes_fts, 3, ?, ?, '…', 12),
+			snippet(recipes_fts, 4, ?, ?, '…', 12)
+		FROM recipes_fts JOIN recipes r ON r.id = recipes_fts.id
+		WHERE recipes_fts MATCH ?
+		ORDER BY bm25(recipes_fts, `+rankWeights+`), r.name COLLATE NOCASE
+		LIMIT ?`,
+		markOpen, markClose, markOpen, markClose, markOpen, markClose, markOpen, markClose, match, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var res SearchResult
+		var name, ingredients, steps, props string
+		if err := rows.Scan(&res.ID, &res.Name, &res.Score, &name, &ingredients, &steps, &props); err != nil {
+			return nil, err
+		}
+		res.Highlights = make(map[string]string)
+		for field, text := range map[string]string{"name": name, "ingredients": ingredients, "steps": steps, "props": props} {
+			// Only fields that actually matched are worth showing
+			if strings.Contains(text, markOpen) {
+				res.Highlights[field] = markHTML(text)
+			}
+		}
+		results = append(results, res)
+	}
+	return results, rows.Err()
+}
+
+// markHTML escapes recipe text for HTML and turns the match markers into <mark> tags
+func markHTML(text string) string {
+	text = strings.ReplaceAll(text, "\n", " / ")
+	return strings.NewReplacer(markOpen, "<mark>", markClose, "</mark>").Replace(html.EscapeString(text))
+}
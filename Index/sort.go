@@ -0,0 +1,134 @@
+package index
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Lists are sorted on a single string key per recipe, with the ID breaking
+// ties, so a cursor is just the key and ID of the last recipe on a page.
+// Pages stay stable when recipes are added or removed in between requests.
+
+// SortFields are the accepted values of ?sort=, each optionally prefixed with
+// "-" for descending order
+var SortFields = []string{"name", "created", "updated", "total_time"}
+
+// ErrInvalidCursor is returned for a cursor that is malformed or was issued
+// for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// minutes rounds a duration read by rfp.ParseDuration to whole minutes,
+// giving nil for a time that is missing
+func minutes(d time.Duration) *int {
+	if d <= 0 {
+		return nil
+	}
+	n := int(d.Round(time.Minute) / time.Minute)
+	return &n
+}
+
+// ParseSort validates a ?sort= value, defaulting to name
+func ParseSort(s string) (string, error) {
+	if s == "" {
+		return "name", nil
+	}
+	for _, field := range SortFields {
+		if strings.TrimPrefix(s, "-") == field {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("sort must be one of %s, optionally prefixed with -", strings.Join(SortFields, ", "))
+}
+
+// sortKey is the value recipes are ordered by. Times are zero-padded so they
+// compare as strings; recipes without a total time sort last either way.
+func sortKey(r RecipeInfo, field string) string {
+	switch strings.TrimPrefix(field, "-") {
+	case "created":
+		return fmt.Sprintf("%020d", r.Created.UnixNano())
+	case "updated":
+		return fmt.Sprintf("%020d", r.Updated.UnixNano())
+	case "total_time":
+		if r.TotalMinutes == nil {
+			if strings.HasPrefix(field, "-") {
+				return ""
+			}
+			return "~"
+		}
+		return fmt.Sprintf("%010d", *r.TotalMinutes)
+	default:
+		return strings.ToLower(r.Name)
+	}
+}
+
+// cursor is the position after which the next page starts
+type cursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   string `json:"i"`
+}
+
+// before reports whether (keyA, idA) comes before (keyB, idB) in the given order
+func before(keyA, idA, keyB, idB string, desc bool) bool {
+	if keyA != keyB {
+		return (keyA < keyB) != desc
+	}
+	if idA == idB {
+		return false
+	}
+	return (idA < idB) != desc
+}
+
+// Paginate sorts recipes by field and returns the page of up to limit recipes
+// following the cursor (the first page for ""), plus the cursor for the next
+// page, which is "" on the last page
+func Paginate(recipes []RecipeInfo, field, after string, limit int) ([]RecipeInfo, string, error) {
+	desc := strings.HasPrefix(field, "-")
+	keys := make(map[string]string, len(recipes))
+	for _, r := range recipes {
+		keys[r.ID] = sortKey(r, field)
+	}
+	sort.Slice(recipes, func(i, j int) bool {
+		return before(keys[recipes[i].ID], recipes[i].ID, keys[recipes[j].ID], recipes[j].ID, desc)
+	})
+
+	start := 0
+	if after != "" {
+		c, err := decodeCursor(after)
+		if err != nil || c.Sort != field {
+			return nil, "", ErrInvalidCursor
+		}
+		start = sort.Search(len(recipes), func(i int) bool {
+			return before(c.Key, c.ID, keys[recipes[i].ID], recipes[i].ID, desc)
+		})
+	}
+
+	end := min(start+limit, len(recipes))
+	page := recipes[start:end]
+	next := ""
+	if end < len(recipes) && len(page) > 0 {
+		last := page[len(page)-1]
+		next = encodeCursor(cursor{Sort: field, Key: keys[last.ID], ID: last.ID})
+	}
+	return page, next, nil
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
@@ -0,0 +1,380 @@
+package rfp
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A library export is a zip holding:
+//
+//	manifest.json     ExportManifest
+//	recipes/<id>.rfp  every recipe file, as stored
+//	images/<name>     every image a recipe references
+//	collections.json  the collections manifest, if there is one
+//
+// Import copies images into the content-addressed store and rewrites each
+// recipe's ImagePath to the resulting ref, so paths resolve on any machine.
+
+const exportVersion = 1
+
+// Caps on decompressed entry sizes, so a crafted archive can't fill the disk
+const (
+	maxImportRecipeSize = 10 << 20
+	maxImportImageSize  = 50 << 20
+)
+
+// ConflictPolicy decides what import does with a recipe whose ID already exists
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"      // keep the existing recipe
+	ConflictOverwrite ConflictPolicy = "overwrite" // replace it with the imported one
+	ConflictRename    ConflictPolicy = "rename"    // import under a new ID such as "pastabake2"
+)
+
+// ParseConflictPolicy validates a policy name; empty means skip
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(strings.ToLower(s)); p {
+	case "":
+		return ConflictSkip, nil
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q (use skip, overwrite or rename)", s)
+}
+
+type ExportManifest struct {
+	Version   int              `json:"version"`
+	CreatedAt time.Time        `json:"created_at"`
+	Recipes   []ExportedRecipe `json:"recipes"`
+}
+
+type ExportedRecipe struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Image string `json:"image,omitempty"` // name under images/ in the archive
+}
+
+// ImportReport describes what an import did, or would do on a dry run
+type ImportReport struct {
+	DryRun  bool             `json:"dry_run"`
+	Policy  ConflictPolicy   `json:"policy"`
+	Recipes []ImportedRecipe `json:"recipes"`
+	Images  int              `json:"images"` // images copied into the store
+	Errors  []string         `json:"errors"`
+}
+
+type ImportedRecipe struct {
+	ID     string `json:"id"`               // ID in the archive
+	NewID  string `json:"new_id,omitempty"` // ID it was imported as, when renamed or made canonical
+	Name   string `json:"name"`
+	Action string `json:"action"` // "create", "skip", "overwrite" or "rename"
+}
+
+// ImageFilePath returns where a recipe's ImagePath lives on disk, or "" if the image is missing.
+// The result is always inside DefaultImagePath.
+func ImageFilePath(cfg *Config, imagePath string) string {
+	if imagePath == "" {
+		return ""
+	}
+	name := imagePath
+	if !IsImageRef(imagePath) {
+		// Older scrapes stored paths like `images/\Name` relative to the working
+		// directory; only the file name is used, so the path can't leave the image directory
+		name = path.Base(strings.ReplaceAll(imagePath, `\`, "/"))
+		if name == "." || name == ".." || name == "/" {
+			return ""
+		}
+	}
+	candidate := filepath.Join(cfg.DefaultImagePath, name)
+	if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+		return candidate
+	}
+	return ""
+}
+
+// ExportLibrary writes every recipe, its image and the collections manifest to w as a zip
+func ExportLibrary(cfg *Config, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	manifest := ExportManifest{Version: exportVersion, CreatedAt: time.Now(), Recipes: []ExportedRecipe{}}
+	written := make(map[string]bool)
+
+	files, err := os.ReadDir(cfg.DefaultRecipePath)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if filepath.Ext(file.Name()) != ".rfp" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(cfg.DefaultRecipePath, file.Name()))
+		if err != nil {
+			return err
+		}
+		recipe, err := DecodeRecipe(data)
+		if err != nil {
+			continue // skip corrupted files
+		}
+
+		entry := ExportedRecipe{ID: strings.TrimSuffix(file.Name(), ".rfp"), Name: recipe.Name}
+		if err := writeZipFile(zw, "recipes/"+file.Name(), data); err != nil {
+			return err
+		}
+
+		if imageFile := ImageFilePath(cfg, recipe.ImagePath); imageFile != "" {
+			entry.Image = filepath.Base(imageFile)
+			if !written[entry.Image] {
+				imageData, err := os.ReadFile(imageFile)
+				if err != nil {
+					return err
+				}
+				if err := writeZipFile(zw, "images/"+entry.Image, imageData); err != nil {
+					return err
+				}
+				written[entry.Image] = true
+			}
+		}
+		manifest.Recipes = append(manifest.Recipes, entry)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(cfg.DefaultRecipePath, CollectionsFile)); err == nil {
+		if err := writeZipFile(zw, CollectionsFile, data); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	if err := writeZipFile(zw, "manifest.json", data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ImportLibrary reads an archive made by ExportLibrary into the library.
+// With dryRun set nothing is written, but the report says what would happen.
+func ImportLibrary(cfg *Config, r io.ReaderAt, size int64, policy ConflictPolicy, dryRun bool) (*ImportReport, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not a zip archive: %v", err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	mf, ok := files["manifest.json"]
+	if !ok {
+		return nil, fmt.Errorf("archive has no manifest.json")
+	}
+	data, err := readZipFile(mf, maxImportRecipeSize)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ExportManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if manifest.Version > exportVersion {
+		return nil, fmt.Errorf("archive version %d is newer than this server supports", manifest.Version)
+	}
+
+	report := &ImportReport{DryRun: dryRun, Policy: policy, Recipes: []ImportedRecipe{}, Errors: []string{}}
+	imageRefs := make(map[string]string) // archive image name -> store ref
+	idMap := make(map[string]string)     // archive recipe ID -> imported ID
+	taken := make(map[string]bool)       // IDs claimed by renames earlier in this import
+
+	for _, entry := range manifest.Recipes {
+		// IDs come from an untrusted archive and name a file inside it, so only
+		// a plain file name is allowed. Recipes written before IDs were
+		// canonical ("chicken_tikka") are imported under their RecipeID.
+		if !safeArchiveID(entry.ID) || RecipeID(entry.ID) == "" {
+			report.Errors = append(report.Errors, fmt.Sprintf("%q: invalid recipe ID", entry.ID))
+			continue
+		}
+		rf, ok := files["recipes/"+entry.ID+".rfp"]
+		if !ok {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: recipe file missing from archive", entry.ID))
+			continue
+		}
+		data, err := readZipFile(rf, maxImportRecipeSize)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", entry.ID, err))
+			continue
+		}
+		recipe, err := DecodeRecipe(data)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", entry.ID, err))
+			continue
+		}
+
+		result := ImportedRecipe{ID: entry.ID, Name: recipe.Name, Action: "create"}
+		targetID := RecipeID(entry.ID)
+		if recipeExists(cfg, targetID) || taken[targetID] {
+			switch policy {
+			case ConflictSkip:
+				result.Action = "skip"
+				report.Recipes = append(report.Recipes, result)
+				continue
+			case ConflictOverwrite:
+				result.Action = "overwrite"
+			case ConflictRename:
+				targetID = freeRecipeID(cfg, targetID, taken)
+				result.Action = "rename"
+			}
+		}
+		if targetID != entry.ID {
+			result.NewID = targetID
+		}
+		taken[targetID] = true
+
+		// Images go into the store; the recipe is rewritten to point at the ref
+		recipe.ImagePath = ""
+		if entry.Image != "" {
+			ref, err := importImage(cfg, files, entry.Image, imageRefs, report, dryRun)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: image: %v", entry.ID, err))
+			}
+			recipe.ImagePath = ref
+		}
+
+		if !dryRun {
+			if err := WriteRecipe(cfg.DefaultRecipePath, targetID, *recipe); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", entry.ID, err))
+				continue
+			}
+		}
+		idMap[entry.ID] = targetID
+		report.Recipes = append(report.Recipes, result)
+	}
+
+	if cf, ok := files[CollectionsFile]; ok && !dryRun {
+		if err := importCollections(cfg, cf, idMap); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("collections: %v", err))
+		}
+	}
+
+	return report, nil
+}
+
+// importImage stores an archive image once, however many recipes use it
+func importImage(cfg *Config, files map[string]*zip.File, name string, refs map[string]string, report *ImportReport, dryRun bool) (string, error) {
+	if ref, ok := refs[name]; ok {
+		return ref, nil
+	}
+	f, ok := files["images/"+path.Base(name)]
+	if !ok {
+		return "", fmt.Errorf("%s missing from archive", name)
+	}
+	data, err := readZipFile(f, maxImportImageSize)
+	if err != nil {
+		return "", err
+	}
+
+	ref := name
+	if !dryRun {
+		if ref, err = StoreImage(cfg.DefaultImagePath, bytes.NewReader(data)); err != nil {
+			return "", err
+		}
+	}
+	refs[name] = ref
+	report.Images++
+	return ref, nil
+}
+
+// importCollections merges archived collections into the manifest, creating
+// missing ones and adding imported recipes under their possibly renamed IDs
+func importCollections(cfg *Config, f *zip.File, idMap map[string]string) error {
+	data, err := readZipFile(f, maxImportRecipeSize)
+	if err != nil {
+		return err
+	}
+	var imported []Collection
+	if err := json.Unmarshal(data, &imported); err != nil {
+		return err
+	}
+
+	return updateCollections(cfg, func(collections []Collection) ([]Collection, error) {
+		for _, ic := range imported {
+			i := findCollection(collections, ic.ID)
+			if i < 0 {
+				collections = append(collections, Collection{ID: ic.ID, Name: ic.Name, Parent: ic.Parent, Recipes: []string{}})
+				i = len(collections) - 1
+			}
+			for _, recipeID := range ic.Recipes {
+				newID, ok := idMap[recipeID]
+				if !ok {
+					continue // skipped or failed
+				}
+				collections[i].Recipes = append(removeString(collections[i].Recipes, newID), newID)
+			}
+		}
+		// Drop parents that did not come along, rather than leave dangling references
+		for i := range collections {
+			if collections[i].Parent != "" && findCollection(collections, collections[i].Parent) < 0 {
+				collections[i].Parent = ""
+			}
+		}
+		return collections, nil
+	})
+}
+
+func recipeExists(cfg *Config, id string) bool {
+	_, err := os.Stat(filepath.Join(cfg.DefaultRecipePath, id+".rfp"))
+	return err == nil
+}
+
+// safeArchiveID reports whether an archive's recipe ID is a plain file name
+func safeArchiveID(id string) bool {
+	return id != "" && id != "." && id != ".." && !strings.ContainsAny(id, "/\\:\x00")
+}
+
+// freeRecipeID returns the first of id2, id3, ... that is not in use
+func freeRecipeID(cfg *Config, id string, taken map[string]bool) string {
+	for n := 2; ; n++ {
+		candidate := id + strconv.Itoa(n)
+		if !recipeExists(cfg, candidate) && !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func readZipFile(f *zip.File, limit int64) ([]byte, error) {
+	if f.UncompressedSize64 > uint64(limit) {
+		return nil, fmt.Errorf("%s is too large", f.Name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	// The header size can lie; enforce the limit on what is actually read too
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is too large", f.Name)
+	}
+	return data, nil
+}
@@ -0,0 +1,395 @@
+package rfp
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A backup is a zip of the recipe and image directories under "recipes/" and
+// "images/", plus checksums.json mapping every entry to its SHA-256. Restores
+// verify every entry against it before anything on disk is touched.
+
+const (
+	backupPrefix     = "backup-"
+	backupTimeFormat = "20060102-150405"
+	backupChecksums  = "checksums.json"
+)
+
+// BackupInfo describes a backup archive in the backup directory
+type BackupInfo struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BackupDir returns the configured backup directory, falling back to "backups/"
+// for configs written before backups existed
+func BackupDir(cfg *Config) string {
+	if cfg.BackupPath == "" {
+		return "backups/"
+	}
+	return cfg.BackupPath
+}
+
+// CreateBackup snapshots the recipe and image directories into a new timestamped
+// archive, then deletes the oldest archives beyond cfg.BackupKeep. It returns the archive name.
+func CreateBackup(cfg *Config) (string, error) {
+	dir := BackupDir(cfg)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	started := time.Now()
+	tmp, err := os.CreateTemp(dir, ".backup-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := zip.NewWriter(tmp)
+	checksums := make(map[string]string)
+	if err := addDirToZip(zw, cfg.DefaultRecipePath, "recipes", checksums); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := addDirToZip(zw, cfg.DefaultImagePath, "images", checksums); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	data, err := json.MarshalIndent(checksums, "", "  ")
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := writeZipFile(zw, backupChecksums, data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	name, err := publishBackup(dir, tmp.Name(), started)
+	if err != nil {
+		return "", err
+	}
+	return name, rotateBackups(cfg)
+}
+
+// publishBackup gives the finished archive at tmp its name after t. Nothing
+// named like a backup exists until the archive is complete, and two backups in
+// the same second never overwrite each other: later ones get a "-2", "-3"...
+// suffix, always above any already used, so the newest archive also sorts
+// newest after rotation has removed earlier ones.
+func publishBackup(dir, tmp string, t time.Time) (string, error) {
+	stamp := t.Format(backupTimeFormat)
+	n := 1
+	if files, err := os.ReadDir(dir); err == nil {
+		for _, file := range files {
+			if created, seq, ok := parseBackupName(file.Name()); ok && created.Format(backupTimeFormat) == stamp && seq >= n {
+				n = seq + 1
+			}
+		}
+	}
+	for ; ; n++ {
+		name := backupPrefix + stamp + ".zip"
+		if n > 1 {
+			name = fmt.Sprintf("%s%s-%d.zip", backupPrefix, stamp, n)
+		}
+		// Link rather than rename: it fails instead of replacing an archive
+		// another backup published under the same name
+		err := os.Link(tmp, filepath.Join(dir, name))
+		if err == nil {
+			return name, nil
+		}
+		if !os.IsExist(err) {
+			return "", fmt.Errorf("failed to save backup: %v", err)
+		}
+	}
+}
+
+// parseBackupName reads the time and same-second sequence number from an archive name
+func parseBackupName(name string) (time.Time, int, bool) {
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), ".zip")
+	seq := 1
+	if len(stamp) > len(backupTimeFormat) {
+		n, err := strconv.Atoi(strings.TrimPrefix(stamp[len(backupTimeFormat):], "-"))
+		if err != nil || n < 2 {
+			return time.Time{}, 0, false
+		}
+		stamp, seq = stamp[:len(backupTimeFormat)], n
+	}
+	created, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	return created, seq, true
+}
+
+// ListBackups returns the archives in the backup directory, newest first
+func ListBackups(cfg *Config) ([]BackupInfo, error) {
+	files, err := os.ReadDir(BackupDir(cfg))
+	if os.IsNotExist(err) {
+		return []BackupInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []BackupInfo{}
+	seqs := make(map[string]int) // orders backups made in the same second
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasPrefix(name, backupPrefix) || filepath.Ext(name) != ".zip" {
+			continue
+		}
+		created, seq, ok := parseBackupName(name)
+		if !ok {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, BackupInfo{Name: name, Size: info.Size(), CreatedAt: created})
+		seqs[name] = seq
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].CreatedAt.Equal(backups[j].CreatedAt) {
+			return backups[i].CreatedAt.After(backups[j].CreatedAt)
+		}
+		return seqs[backups[i].Name] > seqs[backups[j].Name]
+	})
+	return backups, nil
+}
+
+// VerifyBackup checks that every entry in a backup archive is intact and listed
+// in its checksums. Reading each entry also checks the zip CRC32.
+func VerifyBackup(cfg *Config, name string) error {
+	if name != filepath.Base(name) {
+		return fmt.Errorf("invalid backup name")
+	}
+	zr, err := zip.OpenReader(filepath.Join(BackupDir(cfg), name))
+	if err != nil {
+		return fmt.Errorf("not a valid archive: %v", err)
+	}
+	defer zr.Close()
+	return verifyBackup(&zr.Reader)
+}
+
+func verifyBackup(zr *zip.Reader) error {
+	var checksums map[string]string
+	seen := make(map[string]bool)
+	for _, f := range zr.File {
+		if f.Name != backupChecksums {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = json.NewDecoder(rc).Decode(&checksums)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", backupChecksums, err)
+		}
+	}
+	if checksums == nil {
+		return fmt.Errorf("archive has no %s", backupChecksums)
+	}
+
+	for _, f := range zr.File {
+		if f.Name == backupChecksums {
+			continue
+		}
+		if !safeBackupEntry(f.Name) {
+			return fmt.Errorf("unexpected entry %q", f.Name)
+		}
+		want, ok := checksums[f.Name]
+		if !ok {
+			return fmt.Errorf("%s is not listed in %s", f.Name, backupChecksums)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s is corrupt: %v", f.Name, err)
+		}
+		if hex.EncodeToString(hash.Sum(nil)) != want {
+			return fmt.Errorf("%s does not match its checksum", f.Name)
+		}
+		seen[f.Name] = true
+	}
+	for name := range checksums {
+		if !seen[name] {
+			return fmt.Errorf("%s is missing from the archive", name)
+		}
+	}
+	return nil
+}
+
+// RestoreBackup verifies a backup and replaces the recipe and image directories
+// with its contents. The current directories are kept alongside with a
+// ".before-restore-<time>" suffix rather than deleted.
+func RestoreBackup(cfg *Config, name string) error {
+	if err := VerifyBackup(cfg, name); err != nil {
+		return fmt.Errorf("backup failed verification, nothing restored: %v", err)
+	}
+	zr, err := zip.OpenReader(filepath.Join(BackupDir(cfg), name))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	recipeDir := filepath.Clean(cfg.DefaultRecipePath)
+	imageDir := filepath.Clean(cfg.DefaultImagePath)
+	stage := map[string]string{
+		"recipes": recipeDir + ".restore-tmp",
+		"images":  imageDir + ".restore-tmp",
+	}
+	for _, dir := range stage {
+		os.RemoveAll(dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	// Extract everything before swapping, so a failure leaves the library as it was
+	for _, f := range zr.File {
+		if f.Name == backupChecksums {
+			continue
+		}
+		top, rest, _ := strings.Cut(f.Name, "/")
+		dest := filepath.Join(stage[top], filepath.FromSlash(rest))
+		if err := extractZipFile(f, dest); err != nil {
+			for _, dir := range stage {
+				os.RemoveAll(dir)
+			}
+			return err
+		}
+	}
+
+	suffix := ".before-restore-" + time.Now().Format(backupTimeFormat)
+	for _, swap := range []struct{ live, staged string }{{recipeDir, stage["recipes"]}, {imageDir, stage["images"]}} {
+		if _, err := os.Stat(swap.live); err == nil {
+			if err := os.Rename(swap.live, swap.live+suffix); err != nil {
+				return fmt.Errorf("failed to move %s aside: %v", swap.live, err)
+			}
+		}
+		if err := os.Rename(swap.staged, swap.live); err != nil {
+			return fmt.Errorf("failed to restore %s: %v", swap.live, err)
+		}
+	}
+	return nil
+}
+
+// rotateBackups deletes the oldest archives so at most cfg.BackupKeep remain.
+// A BackupKeep of 0 keeps every archive.
+func rotateBackups(cfg *Config) error {
+	if cfg.BackupKeep <= 0 {
+		return nil
+	}
+	backups, err := ListBackups(cfg)
+	if err != nil {
+		return err
+	}
+	for i := cfg.BackupKeep; i < len(backups); i++ {
+		if err := os.Remove(filepath.Join(BackupDir(cfg), backups[i].Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addDirToZip adds every file under dir to the archive under prefix,
+// recording checksums. Resized image variants are derived data and skipped, as
+// are hidden files and directories such as .git.
+func addDirToZip(zw *zip.Writer, dir, prefix string, checksums map[string]string) error {
+	return filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			// Resized variants, and hidden directories such as .git
+			if p != dir && (d.Name() == variantDir || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			return nil // in-progress uploads and temp files
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := prefix + "/" + filepath.ToSlash(rel)
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		hash := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(w, hash), f); err != nil {
+			return err
+		}
+		checksums[name] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+}
+
+// safeBackupEntry accepts only relative paths inside recipes/ or images/
+func safeBackupEntry(name string) bool {
+	if !strings.HasPrefix(name, "recipes/") && !strings.HasPrefix(name, "images/") {
+		return false
+	}
+	return path.Clean(name) == name && !strings.Contains(name, `\`)
+}
+
+func extractZipFile(f *zip.File, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,315 @@
+package rfp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Collections live in a manifest next to the recipes rather than as
+// subdirectories, so one recipe can belong to several collections without
+// being copied. Collections nest through Parent.
+
+// CollectionsFile is the manifest's name inside the recipe directory
+const CollectionsFile = "collections.json"
+
+var (
+	ErrCollectionNotFound = errors.New("collection not found")
+	ErrCollectionExists   = errors.New("a collection with that ID already exists")
+	ErrCollectionCycle    = errors.New("a collection cannot be nested inside itself")
+	ErrNotInCollection    = errors.New("recipe is not in that collection")
+)
+
+// errUnchanged lets an update skip rewriting a manifest it didn't change
+var errUnchanged = errors.New("collections unchanged")
+
+// collectionsMu serialises read-modify-write cycles on the manifest
+var collectionsMu sync.Mutex
+
+// Collection is a named group of recipes, e.g. "Holiday" or "Grandma's Box"
+type Collection struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Parent  string   `json:"parent,omitempty"` // ID of the enclosing collection
+	Recipes []string `json:"recipes"`          // recipe IDs; kept while a recipe is in the trash so a restore puts it back
+}
+
+// LoadCollections reads the collections manifest. A missing manifest means no collections.
+func LoadCollections(cfg *Config) ([]Collection, error) {
+	data, err := os.ReadFile(filepath.Join(cfg.DefaultRecipePath, CollectionsFile))
+	if os.IsNotExist(err) {
+		return []Collection{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var collections []Collection
+	if err := json.Unmarshal(data, &collections); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", CollectionsFile, err)
+	}
+	return collections, nil
+}
+
+// saveCollections writes the manifest through a temp file so a crash never leaves it half written
+func saveCollections(cfg *Config, collections []Collection) error {
+	data, err := json.MarshalIndent(collections, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal collections: %v", err)
+	}
+	tmp := filepath.Join(cfg.DefaultRecipePath, CollectionsFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write collections: %v", err)
+	}
+	return os.Rename(tmp, filepath.Join(cfg.DefaultRecipePath, CollectionsFile))
+}
+
+// updateCollections loads the manifest, applies fn and saves the result if fn succeeds
+func updateCollections(cfg *Config, fn func([]Collection) ([]Collection, error)) error {
+	collectionsMu.Lock()
+	defer collectionsMu.Unlock()
+
+	collections, err := LoadCollections(cfg)
+	if err != nil {
+		return err
+	}
+	collections, err = fn(collections)
+	if err == errUnchanged {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return saveCollections(cfg, collections)
+}
+
+func findCollection(collections []Collection, id string) int {
+	for i, c := range collections {
+		if c.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkParent verifies that parent exists and that nesting id under it makes no cycle
+func checkParent(collections []Collection, id, parent string) error {
+	for p := parent; p != ""; {
+		if p == id {
+			return ErrCollectionCycle
+		}
+		i := findCollection(collections, p)
+		if i < 0 {
+			return ErrCollectionNotFound
+		}
+		p = collections[i].Parent
+	}
+	return nil
+}
+
+// CreateCollection adds an empty collection, optionally nested under parent.
+// Its ID is derived from the name the same way recipe IDs are.
+func CreateCollection(cfg *Config, name, parent string) (*Collection, error) {
+	c := Collection{ID: RecipeID(strings.ToLower(name)), Name: name, Parent: parent, Recipes: []string{}}
+	if c.ID == "" {
+		return nil, fmt.Errorf("collection name must contain letters or digits")
+	}
+	err := updateCollections(cfg, func(collections []Collection) ([]Collection, error) {
+		if findCollection(collections, c.ID) >= 0 {
+			return nil, ErrCollectionExists
+		}
+		if err := checkParent(collections, c.ID, parent); err != nil {
+			return nil, err
+		}
+		return append(collections, c), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// UpdateCollection renames a collection and/or moves it under a new parent.
+// An empty name keeps the current name and a nil parent the current parent;
+// a parent of "" moves the collection to the top level.
+func UpdateCollection(cfg *Config, id, name string, parent *string) error {
+	return updateCollections(cfg, func(collections []Collection) ([]Collection, error) {
+		i := findCollection(collections, id)
+		if i < 0 {
+			return nil, ErrCollectionNotFound
+		}
+		if parent != nil {
+			if err := checkParent(collections, id, *parent); err != nil {
+				return nil, err
+			}
+			collections[i].Parent = *parent
+		}
+		if name != "" {
+			collections[i].Name = name
+		}
+		return collections, nil
+	})
+}
+
+// DeleteCollection removes a collection. Its sub-collections move up to its
+// parent; the recipes themselves are not touched.
+func DeleteCollection(cfg *Config, id string) error {
+	return updateCollections(cfg, func(collections []Collection) ([]Collection, error) {
+		i := findCollection(collections, id)
+		if i < 0 {
+			return nil, ErrCollectionNotFound
+		}
+		parent := collections[i].Parent
+		collections = append(collections[:i], collections[i+1:]...)
+		for j := range collections {
+			if collections[j].Parent == id {
+				collections[j].Parent = parent
+			}
+		}
+		return collections, nil
+	})
+}
+
+// AddToCollection puts a recipe in a collection. Adding it twice is a no-op.
+func AddToCollection(cfg *Config, id, recipeID string) error {
+	return updateCollections(cfg, func(collections []Collection) ([]Collection, error) {
+		i := findCollection(collections, id)
+		if i < 0 {
+			return nil, ErrCollectionNotFound
+		}
+		for _, r := range collections[i].Recipes {
+			if r == recipeID {
+				return collections, nil
+			}
+		}
+		collections[i].Recipes = append(collections[i].Recipes, recipeID)
+		return collections, nil
+	})
+}
+
+// RemoveFromCollection takes a recipe out of a collection
+func RemoveFromCollection(cfg *Config, id, recipeID string) error {
+	return updateCollections(cfg, func(collections []Collection) ([]Collection, error) {
+		i := findCollection(collections, id)
+		if i < 0 {
+			return nil, ErrCollectionNotFound
+		}
+		collections[i].Recipes = removeString(collections[i].Recipes, recipeID)
+		return collections, nil
+	})
+}
+
+// MoveRecipe moves a recipe from one collection to another in a single manifest write.
+// An empty from only adds the recipe to the destination; otherwise the recipe
+// must be in from, or ErrNotInCollection is returned.
+func MoveRecipe(cfg *Config, recipeID, from, to string) error {
+	return updateCollections(cfg, func(collections []Collection) ([]Collection, error) {
+		dst := findCollection(collections, to)
+		if dst < 0 {
+			return nil, ErrCollectionNotFound
+		}
+		if from != "" {
+			src := findCollection(collections, from)
+			if src < 0 {
+				return nil, ErrCollectionNotFound
+			}
+			if !slices.Contains(collections[src].Recipes, recipeID) {
+				return nil, ErrNotInCollection
+			}
+			collections[src].Recipes = removeString(collections[src].Recipes, recipeID)
+		}
+		for _, r := range collections[dst].Recipes {
+			if r == recipeID {
+				return collections, nil
+			}
+		}
+		collections[dst].Recipes = append(collections[dst].Recipes, recipeID)
+		return collections, nil
+	})
+}
+
+// CollectionRecipeIDs returns the IDs of recipes in a collection and all of its sub-collections
+func CollectionRecipeIDs(cfg *Config, id string) (map[string]bool, error) {
+	collections, err := LoadCollections(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if findCollection(collections, id) < 0 {
+		return nil, ErrCollectionNotFound
+	}
+
+	ids := make(map[string]bool)
+	included := map[string]bool{id: true}
+	// Parents may be listed after their children, so repeat until nothing new is found
+	for changed := true; changed; {
+		changed = false
+		for _, c := range collections {
+			if !included[c.ID] && included[c.Parent] {
+				included[c.ID] = true
+				changed = true
+			}
+		}
+	}
+	for _, c := range collections {
+		if included[c.ID] {
+			for _, r := range c.Recipes {
+				ids[r] = true
+			}
+		}
+	}
+	return ids, nil
+}
+
+// RecipeCollections returns the IDs of the collections a recipe belongs to directly
+func RecipeCollections(cfg *Config, recipeID string) ([]string, error) {
+	collections, err := LoadCollections(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, c := range collections {
+		for _, r := range c.Recipes {
+			if r == recipeID {
+				ids = append(ids, c.ID)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// forgetRecipes takes recipes that are gone for good out of every collection
+func forgetRecipes(cfg *Config, ids map[string]bool) error {
+	return updateCollections(cfg, func(collections []Collection) ([]Collection, error) {
+		changed := false
+		for i := range collections {
+			kept := collections[i].Recipes[:0]
+			for _, id := range collections[i].Recipes {
+				if ids[id] {
+					changed = true
+					continue
+				}
+				kept = append(kept, id)
+			}
+			collections[i].Recipes = kept
+		}
+		if !changed {
+			return nil, errUnchanged
+		}
+		return collections, nil
+	})
+}
+
+func removeString(list []string, s string) []string {
+	out := list[:0]
+	for _, item := range list {
+		if item != s {
+			out = append(out, item)
+		}
+	}
+	return out
+}
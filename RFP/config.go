@@ -19,8 +19,33 @@ type Config struct {
 	MaxSteps                   int    `json:"max_steps"`
 	DefaultPort                int    `json:"default_port"`
 	DefaultWebPort             int    `json:"default_web_port"`
+	RequireIfMatch             bool   `json:"require_if_match"` // reject updates/deletes without an If-Match header
+	TrashPath                  string `json:"trash_path"`
+	TrashRetentionDays         int    `json:"trash_retention_days"` // 0 keeps trashed recipes until purged by hand
+	MaxImageUploadMB           int    `json:"max_image_upload_mb"`
+	BackupPath                 string `json:"backup_path"`
+	BackupIntervalHours        int    `json:"backup_interval_hours"` // 0 disables scheduled backups
+	BackupKeep                 int    `json:"backup_keep"`           // 0 keeps every backup
+	GitStorage                 bool   `json:"git_storage"`           // commit every recipe change to a git repo in DefaultRecipePath
+	IndexEnabled               bool   `json:"index_enabled"`         // answer list queries from the SQLite index
+	IndexPath                  string `json:"index_path"`
+	ScrapeDialTimeoutSeconds   int    `json:"scrape_dial_timeout_seconds"`
+	ScrapeTimeoutSeconds       int    `json:"scrape_timeout_seconds"` // per attempt, including reading the body
+	ScrapeUserAgent            string `json:"scrape_user_agent"`
+	ScrapeMaxPageMB            int    `json:"scrape_max_page_mb"`
+	ScrapeMaxImageMB           int    `json:"scrape_max_image_mb"`
+	ScrapeMaxRetries           int    `json:"scrape_max_retries"` // retries on 429 and 5xx; 0 disables them
+	ScrapeWorkers              int    `json:"scrape_workers"`     // background scrape jobs run at once
+
+	// Scraper egress: entries are hosts (with subdomains), IPs or CIDRs
+	ScrapeAllowHosts []string `json:"scrape_allow_hosts"` // may be reached even if not a public address
+	ScrapeDenyHosts  []string `json:"scrape_deny_hosts"`  // never fetched
 }
 
+// defaultScrapeMaxRetries is used when a config has no scrape_max_retries,
+// since 0 there turns retries off
+const defaultScrapeMaxRetries = 2
+
 // LoadConfig reads the JSON config from .config/config.json relative to the repo root
 func LoadConfig() (*Config, error) {
 	configPath := filepath.Join(".config", "config.json")
@@ -28,7 +53,8 @@ func LoadConfig() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	var cfg Config
+	// Settings added since the file was written keep their defaults
+	cfg := Config{ScrapeMaxRetries: defaultScrapeMaxRetries}
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
@@ -61,6 +87,13 @@ func SaveConfig(cfg *Config) error {
 		}
 	}
 
+	// Create trash folder if doesn't exist
+	if _, err := os.Stat(TrashDir(cfg)); os.IsNotExist(err) {
+		if err := os.Mkdir(TrashDir(cfg), 0755); err != nil {
+			return fmt.Errorf("failed to create config directory: %v", err)
+		}
+	}
+
 	// Marshal the config to JSON
 	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
@@ -97,6 +130,25 @@ func CreateConfig() (*Config, error) {
 		MaxSteps:                   100,
 		DefaultPort:                26740,
 		DefaultWebPort:             10105,
+		RequireIfMatch:             false,
+		TrashPath:                  "trash/",
+		TrashRetentionDays:         30,
+		MaxImageUploadMB:           10,
+		BackupPath:                 "backups/",
+		BackupIntervalHours:        24,
+		BackupKeep:                 7,
+		GitStorage:                 false,
+		IndexEnabled:               true,
+		IndexPath:                  ".config/recipes.db",
+		ScrapeDialTimeoutSeconds:   10,
+		ScrapeTimeoutSeconds:       30,
+		ScrapeUserAgent:            "RecipeServer/1.0 (+https://github.com/CaptSniper/RecipeServer)",
+		ScrapeMaxPageMB:            5,
+		ScrapeMaxImageMB:           10,
+		ScrapeMaxRetries:           defaultScrapeMaxRetries,
+		ScrapeWorkers:              2,
+		ScrapeAllowHosts:           []string{},
+		ScrapeDenyHosts:            []string{},
 	}
 
 	// Write to config.json
@@ -137,6 +189,25 @@ func EditConfig(cfg *Config) {
 		return current
 	}
 
+	promptList := func(field string, current []string) []string {
+		fmt.Printf("%s [%s] (comma separated, - to clear): ", field, strings.Join(current, ", "))
+		input, _ := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+		switch input {
+		case "":
+			return current
+		case "-":
+			return []string{}
+		}
+		list := []string{}
+		for _, item := range strings.Split(input, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+
 	promptBool := func(field string, current bool) bool {
 		fmt.Printf("%s [%t] (true/false): ", field, current)
 		input, _ := reader.ReadString('\n')
@@ -158,6 +229,25 @@ func EditConfig(cfg *Config) {
 	cfg.MaxSteps = promptInt("Max steps", cfg.MaxSteps)
 	cfg.DefaultPort = promptInt("Default API Port", cfg.DefaultPort)
 	cfg.DefaultWebPort = promptInt("Default Web Port", cfg.DefaultWebPort)
+	cfg.RequireIfMatch = promptBool("Require If-Match on updates", cfg.RequireIfMatch)
+	cfg.TrashPath = promptString("Trash path", cfg.TrashPath)
+	cfg.TrashRetentionDays = promptInt("Trash retention (days, 0 = forever)", cfg.TrashRetentionDays)
+	cfg.MaxImageUploadMB = promptInt("Max image upload size (MB)", cfg.MaxImageUploadMB)
+	cfg.BackupPath = promptString("Backup path", cfg.BackupPath)
+	cfg.BackupIntervalHours = promptInt("Backup interval (hours, 0 = off)", cfg.BackupIntervalHours)
+	cfg.BackupKeep = promptInt("Backups to keep (0 = all)", cfg.BackupKeep)
+	cfg.GitStorage = promptBool("Store recipes in git", cfg.GitStorage)
+	cfg.IndexEnabled = promptBool("Use SQLite index", cfg.IndexEnabled)
+	cfg.IndexPath = promptString("SQLite index path", cfg.IndexPath)
+	cfg.ScrapeDialTimeoutSeconds = promptInt("Scraper connect timeout (seconds)", cfg.ScrapeDialTimeoutSeconds)
+	cfg.ScrapeTimeoutSeconds = promptInt("Scraper request timeout (seconds)", cfg.ScrapeTimeoutSeconds)
+	cfg.ScrapeUserAgent = promptString("Scraper User-Agent", cfg.ScrapeUserAgent)
+	cfg.ScrapeMaxPageMB = promptInt("Max scraped page size (MB)", cfg.ScrapeMaxPageMB)
+	cfg.ScrapeMaxImageMB = promptInt("Max scraped image size (MB)", cfg.ScrapeMaxImageMB)
+	cfg.ScrapeMaxRetries = promptInt("Scraper retries on 429/5xx (0 = none)", cfg.ScrapeMaxRetries)
+	cfg.ScrapeWorkers = promptInt("Scrape jobs run at once", cfg.ScrapeWorkers)
+	cfg.ScrapeAllowHosts = promptList("Scraper allowed private hosts/CIDRs", cfg.ScrapeAllowHosts)
+	cfg.ScrapeDenyHosts = promptList("Scraper denied hosts/CIDRs", cfg.ScrapeDenyHosts)
 
 	// Save updates
 	if err := SaveConfig(cfg); err != nil {
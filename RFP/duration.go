@@ -0,0 +1,133 @@
+package rfp
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Times live in CoreProps as whatever text the recipe came with ("1 hr 15 mins",
+// "PT1H15M", "75"). EncodeRecipe parses them once and stores the durations in
+// a TIME chunk, so reading a saved recipe's times doesn't parse the text again.
+
+// Times are a recipe's durations. A zero duration means the time is missing or
+// can't be read.
+type Times struct {
+	Prep       time.Duration
+	Cook       time.Duration
+	Additional time.Duration
+	Total      time.Duration
+}
+
+var (
+	isoDurationRegex     = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)W)?(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+	clockDurationRegex   = regexp.MustCompile(`^(\d+):([0-5]\d)$`)
+	compactDurationRegex = regexp.MustCompile(`([a-z])(\d)`)
+	durationPartRegex    = regexp.MustCompile(`(` + quantityPattern + `)\s*(weeks?|wks?|days?|d|hours?|hrs?|h|minutes?|mins?|m|seconds?|secs?|s)\b`)
+)
+
+// Times returns the recipe's durations: those stored in its file, or for a
+// recipe that was never saved with them, its "prep time", "cook time",
+// "additional time" and "total time" properties parsed now.
+func (r *Recipe) Times() Times {
+	if r.times != nil {
+		return *r.times
+	}
+	return parseTimes(r.CoreProps)
+}
+
+// parseTimes reads the time properties, whatever their case. When there is no
+// readable total time it is the sum of the others.
+func parseTimes(props map[string]string) Times {
+	var t Times
+	t.Prep, _ = ParseDuration(lookupProp(props, "prep time"))
+	t.Cook, _ = ParseDuration(lookupProp(props, "cook time"))
+	t.Additional, _ = ParseDuration(lookupProp(props, "additional time"))
+	t.Total, _ = ParseDuration(lookupProp(props, "total time"))
+	if t.Total == 0 {
+		t.Total = t.Prep + t.Cook + t.Additional
+	}
+	return t
+}
+
+// ParseDuration reads a recipe time: an ISO 8601 duration ("PT1H15M"), text
+// such as "1 hr 15 mins", "1½ hours" or "half an hour", hours and minutes as
+// "1:15", or a bare number of minutes. A range such as "15-20 minutes" gives
+// its upper end. The second result is false when s holds no time.
+func ParseDuration(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	if m := isoDurationRegex.FindStringSubmatch(strings.ToUpper(s)); m != nil && len(s) > 1 && !strings.HasSuffix(strings.ToUpper(s), "T") {
+		var d float64
+		for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+			n, _ := strconv.ParseFloat(m[i+1], 64)
+			d += n * float64(unit)
+		}
+		return time.Duration(d), true
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil && n >= 0 {
+		return time.Duration(n * float64(time.Minute)), true
+	}
+	if m := clockDurationRegex.FindStringSubmatch(s); m != nil {
+		hours, _ := strconv.Atoi(m[1])
+		mins, _ := strconv.Atoi(m[2])
+		return time.Duration(hours)*time.Hour + time.Duration(mins)*time.Minute, true
+	}
+
+	text := normaliseIngredient(strings.ToLower(s))
+	text = compactDurationRegex.ReplaceAllString(text, "$1 $2") // "1h15m"
+	text = strings.NewReplacer("half an hour", "30 minutes", "half a hour", "30 minutes", "an hour", "1 hour", "a hour", "1 hour").Replace(text)
+	parts := durationPartRegex.FindAllStringSubmatch(text, -1)
+	if parts == nil {
+		return 0, false
+	}
+	var d float64
+	for _, part := range parts {
+		n := parseQuantity(part[1])
+		switch unit := part[2]; {
+		case strings.HasPrefix(unit, "w"):
+			d += n * float64(7*24*time.Hour)
+		case strings.HasPrefix(unit, "d"):
+			d += n * float64(24*time.Hour)
+		case strings.HasPrefix(unit, "h"):
+			d += n * float64(time.Hour)
+		case strings.HasPrefix(unit, "s"):
+			d += n * float64(time.Second)
+		default:
+			d += n * float64(time.Minute)
+		}
+	}
+	return time.Duration(d), true
+}
+
+// FormatDuration writes d rounded to the minute in the "1 hr 15 mins" form
+// the scrapers store. It returns "" for anything under half a minute.
+func FormatDuration(d time.Duration) string {
+	total := int(d.Round(time.Minute) / time.Minute)
+	if total <= 0 {
+		return ""
+	}
+	var parts []string
+	if total >= 24*60 {
+		parts = append(parts, plural(total/(24*60), "day", "days"))
+		total %= 24 * 60
+	}
+	if total >= 60 {
+		parts = append(parts, plural(total/60, "hr", "hrs"))
+		total %= 60
+	}
+	if total > 0 {
+		parts = append(parts, plural(total, "min", "mins"))
+	}
+	return strings.Join(parts, " ")
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return strconv.Itoa(n) + " " + many
+}
@@ -0,0 +1,90 @@
+package rfp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		// ISO 8601
+		{"PT1H15M", 75 * time.Minute, true},
+		{"pt20m", 20 * time.Minute, true},
+		{"PT1.5H", 90 * time.Minute, true},
+		{"P1DT2H", 26 * time.Hour, true},
+		{"PT30S", 30 * time.Second, true},
+		{"P", 0, false},
+		{"PT", 0, false},
+
+		// Compact and clock forms
+		{"1h15m", 75 * time.Minute, true},
+		{"1:15", 75 * time.Minute, true},
+		{"75", 75 * time.Minute, true},
+
+		// Text
+		{"1 hr 15 mins", 75 * time.Minute, true},
+		{"20 min.", 20 * time.Minute, true},
+		{"1½ hours", 90 * time.Minute, true},
+		{"1 1/2 hours", 90 * time.Minute, true},
+		{"half an hour", 30 * time.Minute, true},
+		{"an hour", time.Hour, true},
+		{"about 10 minutes", 10 * time.Minute, true},
+		{"2 days", 48 * time.Hour, true},
+
+		// Ranges give their upper end
+		{"15-20 minutes", 20 * time.Minute, true},
+		{"15 to 20 mins", 20 * time.Minute, true},
+		{"1–2 hours", 2 * time.Hour, true},
+
+		// No time
+		{"", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseDuration(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRecipeTimesStored(t *testing.T) {
+	r := NewRecipe()
+	r.CoreProps["prep time"] = "15 mins"
+	r.CoreProps["cook time"] = "1 hr"
+
+	decoded, err := DecodeRecipe(EncodeRecipe(*r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Times{Prep: 15 * time.Minute, Cook: time.Hour, Total: 75 * time.Minute}
+	if decoded.times == nil || *decoded.times != want {
+		t.Fatalf("stored times = %v, want %v", decoded.times, want)
+	}
+	if got := decoded.Times(); got != want {
+		t.Errorf("Times() = %v, want %v", got, want)
+	}
+}
+
+func TestRecipeTimesIgnoreKeyCase(t *testing.T) {
+	r := NewRecipe()
+	r.CoreProps["Prep Time"] = "15 mins"
+	r.CoreProps["COOK TIME"] = "PT1H"
+
+	want := Times{Prep: 15 * time.Minute, Cook: time.Hour, Total: 75 * time.Minute}
+	if got := r.Times(); got != want {
+		t.Errorf("Times() = %v, want %v", got, want)
+	}
+	decoded, err := DecodeRecipe(EncodeRecipe(*r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.times == nil || *decoded.times != want {
+		t.Errorf("stored times = %v, want %v", decoded.times, want)
+	}
+}
@@ -0,0 +1,33 @@
+package rfp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RecipeETag returns a strong ETag for a recipe file, derived from its content.
+// Any write to the file produces a different tag.
+func RecipeETag(dir, filename string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, filename))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// ETagMatches reports whether an If-Match / If-None-Match header value matches etag.
+// The header may hold a comma separated list or "*". Weak tags never match, so
+// callers doing the weak comparison of If-None-Match strip the W/ prefix first.
+func ETagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package rfp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// In git storage mode DefaultRecipePath is a git repository and every change
+// to a recipe is committed with the local git binary, giving per-recipe
+// history and letting several machines sync and merge through a remote.
+
+// ErrGitDisabled is returned by history lookups when git storage is off
+var ErrGitDisabled = errors.New("git storage is not enabled")
+
+// gitMu serialises git invocations; git itself refuses concurrent index writes
+var gitMu sync.Mutex
+
+// Used when the machine has no git identity configured
+const (
+	gitFallbackName  = "RecipeServer"
+	gitFallbackEmail = "recipeserver@localhost"
+)
+
+// GitCommit is one entry in a recipe's history
+type GitCommit struct {
+	Hash    string    `json:"hash"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Message string    `json:"message"`
+}
+
+// runGit runs git in the recipe directory and returns its trimmed stdout
+func runGit(cfg *Config, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", cfg.DefaultRecipePath}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// InitGitRepo turns the recipe directory into a git repository if it isn't one yet
+// and commits whatever recipes are already there
+func InitGitRepo(cfg *Config) error {
+	gitMu.Lock()
+	defer gitMu.Unlock()
+	return initGitRepo(cfg)
+}
+
+func initGitRepo(cfg *Config) error {
+	if _, err := os.Stat(filepath.Join(cfg.DefaultRecipePath, ".git")); err == nil {
+		return nil
+	}
+	if _, err := runGit(cfg, "init"); err != nil {
+		return err
+	}
+	// Temp files from atomic writes never belong in history
+	if err := os.WriteFile(filepath.Join(cfg.DefaultRecipePath, ".gitignore"), []byte("*.tmp\n"), 0644); err != nil {
+		return err
+	}
+	return commit(cfg, "Initial import of existing recipes")
+}
+
+// RecordChange commits the given recipe IDs with message when git storage is on.
+// Entries with an extension, such as CollectionsFile, are committed as file
+// names instead. With no IDs every change in the recipe directory is committed.
+// Nothing is committed if the files are unchanged.
+func RecordChange(cfg *Config, message string, ids ...string) error {
+	if !cfg.GitStorage {
+		return nil
+	}
+	gitMu.Lock()
+	defer gitMu.Unlock()
+
+	if err := initGitRepo(cfg); err != nil {
+		return err
+	}
+	paths := []string{"."}
+	if len(ids) > 0 {
+		paths = paths[:0]
+		for _, id := range ids {
+			if filepath.Ext(id) == "" {
+				id += ".rfp"
+			}
+			paths = append(paths, id)
+		}
+	}
+	return commit(cfg, message, paths...)
+}
+
+// commit stages paths (all changes if none are given) and commits only them,
+// so anything else that happens to be staged is left for its own commit
+func commit(cfg *Config, message string, paths ...string) error {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	// A path that doesn't exist and was never committed has nothing to record,
+	// and git would reject the whole pathspec over it
+	known := paths[:0]
+	for _, p := range paths {
+		if _, err := os.Stat(filepath.Join(cfg.DefaultRecipePath, p)); err == nil {
+			known = append(known, p)
+		} else if _, err := runGit(cfg, "ls-files", "--error-unmatch", "--", p); err == nil {
+			known = append(known, p)
+		}
+	}
+	if len(known) == 0 {
+		return nil
+	}
+	paths = known
+	// -A also stages deletions, e.g. a recipe moved to the trash
+	if _, err := runGit(cfg, append([]string{"add", "-A", "--"}, paths...)...); err != nil {
+		return err
+	}
+	if _, err := runGit(cfg, append([]string{"diff", "--cached", "--quiet", "--"}, paths...)...); err == nil {
+		return nil // nothing staged
+	}
+
+	args := append([]string{"commit", "-q", "-m", message, "--"}, paths...)
+	if name, _ := runGit(cfg, "config", "user.name"); name == "" {
+		args = append([]string{"-c", "user.name=" + gitFallbackName}, args...)
+	}
+	if email, _ := runGit(cfg, "config", "user.email"); email == "" {
+		args = append([]string{"-c", "user.email=" + gitFallbackEmail}, args...)
+	}
+	_, err := runGit(cfg, args...)
+	return err
+}
+
+// RecipeHistory returns the commits that touched a recipe, newest first
+func RecipeHistory(cfg *Config, id string) ([]GitCommit, error) {
+	if !cfg.GitStorage {
+		return nil, ErrGitDisabled
+	}
+	gitMu.Lock()
+	defer gitMu.Unlock()
+
+	if err := initGitRepo(cfg); err != nil {
+		return nil, err
+	}
+	out, err := runGit(cfg, "log", "--format=%H%x1f%an%x1f%aI%x1f%s", "--", id+".rfp")
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []GitCommit{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		date, _ := time.Parse(time.RFC3339, fields[2])
+		commits = append(commits, GitCommit{Hash: fields[0], Author: fields[1], Date: date, Message: fields[3]})
+	}
+	return commits, nil
+}
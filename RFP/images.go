@@ -0,0 +1,207 @@
+package rfp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Images in DefaultImagePath are stored under the SHA-256 of their content,
+// e.g. "3a7bd3e2...e1.jpg". Recipes keep that name (the image ref) in ImagePath,
+// so identical images downloaded from different sites are stored once.
+
+var imageRefRegex = regexp.MustCompile(`^[0-9a-f]{64}\.[a-z]+$`)
+
+// imageExts maps sniffed content types to the extension used in the store
+var imageExts = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/bmp":  ".bmp",
+}
+
+// IsImageRef reports whether s names an image in the content-addressed store
+func IsImageRef(s string) bool {
+	return imageRefRegex.MatchString(s)
+}
+
+// IsValidImagePath reports whether a recipe may keep s as its ImagePath: an
+// image ref, an external http(s) URL, or the bare file name of an older image
+// in the image directory. Paths into other directories are refused.
+func IsValidImagePath(s string) bool {
+	if s == "" || IsImageRef(s) || strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+		return true
+	}
+	return !strings.ContainsAny(s, `/\:`) && s != "." && s != ".."
+}
+
+// IsSupportedImageType reports whether the store accepts images of the given sniffed content type
+func IsSupportedImageType(contentType string) bool {
+	_, ok := imageExts[contentType]
+	return ok
+}
+
+// StoreImage copies an image into the store at dir and returns its image ref.
+// If an image with the same content is already stored, the existing file is kept.
+func StoreImage(dir string, src io.Reader) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %v", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), src); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to save image: %v", err)
+	}
+
+	// Sniff the type from the start of what we just wrote
+	head := make([]byte, 512)
+	n, _ := tmp.ReadAt(head, 0)
+	tmp.Close()
+
+	ext, ok := imageExts[http.DetectContentType(head[:n])]
+	if !ok {
+		return "", fmt.Errorf("unsupported image type %q", http.DetectContentType(head[:n]))
+	}
+
+	ref := hex.EncodeToString(hash.Sum(nil)) + ext
+	dest := filepath.Join(dir, ref)
+	if _, err := os.Stat(dest); err == nil {
+		// Already stored; refresh the mtime so the GC grace period covers this use too
+		now := time.Now()
+		os.Chtimes(dest, now, now)
+		return ref, nil
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return "", fmt.Errorf("failed to save image: %v", err)
+	}
+
+	// Variants are regenerated on request if this fails, so don't fail the save
+	GenerateImageVariants(dir, ref)
+	return ref, nil
+}
+
+// StoreImageFile imports an image file from disk into the store at dir
+func StoreImageFile(dir, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return StoreImage(dir, f)
+}
+
+// OpenImage opens an image in the image directory for serving. Store refs can be
+// resized with size; any other name is a legacy download and is served as is.
+// Names are resolved through os.Root, so they can never reach outside dir.
+func OpenImage(dir, name, size string) (*os.File, error) {
+	if IsImageRef(name) {
+		path, err := ImageVariantPath(dir, name, size)
+		if err != nil {
+			return nil, err
+		}
+		return os.Open(path)
+	}
+
+	// Dot files are in-progress uploads, and subdirectories hold derived data
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, os.ErrNotExist
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	return root.Open(name)
+}
+
+// ImageRefs returns the set of image refs used by live and trashed recipes
+func ImageRefs(cfg *Config) (map[string]bool, error) {
+	refs := make(map[string]bool)
+
+	files, err := os.ReadDir(cfg.DefaultRecipePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if filepath.Ext(file.Name()) != ".rfp" {
+			continue
+		}
+		recipe, err := ReadRecipeFile(cfg.DefaultRecipePath, file.Name())
+		if err != nil {
+			// An unreadable recipe might reference anything; refuse to guess
+			return nil, fmt.Errorf("failed to read %s: %v", file.Name(), err)
+		}
+		if IsImageRef(recipe.ImagePath) {
+			refs[recipe.ImagePath] = true
+		}
+	}
+
+	// Trashed recipes can still be restored, so their images stay too
+	entries, err := ListTrash(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		recipe, err := ReadRecipeFile(filepath.Join(TrashDir(cfg), entry.TrashID), entry.ID+".rfp")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trashed %s: %v", entry.ID, err)
+		}
+		if IsImageRef(recipe.ImagePath) {
+			refs[recipe.ImagePath] = true
+		}
+	}
+
+	return refs, nil
+}
+
+// CollectImageGarbage removes stored images that no recipe references and
+// returns the refs it removed. Files not named by content hash are left alone,
+// as are images stored within the last hour that may not be saved in a recipe yet.
+func CollectImageGarbage(cfg *Config) ([]string, error) {
+	refs, err := ImageRefs(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := os.ReadDir(cfg.DefaultImagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() {
+			continue
+		}
+		// Interrupted uploads are cleaned up along with unreferenced images
+		if !strings.HasPrefix(name, ".upload-") && (!IsImageRef(name) || refs[name]) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil || time.Since(info.ModTime()) < time.Hour {
+			continue
+		}
+		if err := os.Remove(filepath.Join(cfg.DefaultImagePath, name)); err != nil {
+			return removed, err
+		}
+		removeImageVariants(cfg.DefaultImagePath, name)
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
@@ -0,0 +1,365 @@
+package rfp
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Ingredients stay free text in .rfp files; ParseIngredient pulls the
+// structure back out when something needs it, e.g. for scaling or matching.
+
+// Ingredient is an ingredient line split into its parts. A line such as
+// "1 ½ cups (200g) all-purpose flour, sifted" gives Quantity 1.5, Unit "cup",
+// Name "all-purpose flour", Alternates ["200g"] and Notes "sifted".
+type Ingredient struct {
+	Raw         string   `json:"raw"`
+	Quantity    float64  `json:"quantity,omitempty"`     // 0 when the line has no amount
+	QuantityMax float64  `json:"quantity_max,omitempty"` // upper end of a range such as "2-3", else equal to Quantity
+	Unit        string   `json:"unit,omitempty"`         // canonical form, see units
+	Name        string   `json:"name"`
+	Alternates  []string `json:"alternates,omitempty"` // text in parentheses, e.g. a metric amount
+	Notes       string   `json:"notes,omitempty"`      // preparation and serving notes
+}
+
+// vulgarFractions maps Unicode fraction characters to their values
+var vulgarFractions = map[rune]float64{
+	'¼': 1.0 / 4, '½': 1.0 / 2, '¾': 3.0 / 4, '⅐': 1.0 / 7, '⅑': 1.0 / 9, '⅒': 1.0 / 10,
+	'⅓': 1.0 / 3, '⅔': 2.0 / 3, '⅕': 1.0 / 5, '⅖': 2.0 / 5, '⅗': 3.0 / 5, '⅘': 4.0 / 5,
+	'⅙': 1.0 / 6, '⅚': 5.0 / 6, '⅛': 1.0 / 8, '⅜': 3.0 / 8, '⅝': 5.0 / 8, '⅞': 7.0 / 8,
+}
+
+// numberWords are amounts written out
+var numberWords = map[string]float64{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+	"dozen": 12, "half": 0.5, "a half": 0.5, "half a": 0.5, "half an": 0.5, "a dozen": 12,
+}
+
+// units maps every spelling of a unit to its canonical form. Two-word units
+// are listed with a single space.
+var units = map[string]string{
+	"cup": "cup", "cups": "cup", "c": "cup",
+	"tablespoon": "tbsp", "tablespoons": "tbsp", "tbsp": "tbsp", "tbsps": "tbsp", "tbs": "tbsp", "tbl": "tbsp", "tbl.": "tbsp",
+	"teaspoon": "tsp", "teaspoons": "tsp", "tsp": "tsp", "tsps": "tsp",
+	"fluid ounce": "fl oz", "fluid ounces": "fl oz", "fl oz": "fl oz", "fl. oz": "fl oz",
+	"ounce": "oz", "ounces": "oz", "oz": "oz",
+	"pound": "lb", "pounds": "lb", "lb": "lb", "lbs": "lb",
+	"gram": "g", "grams": "g", "gramme": "g", "grammes": "g", "g": "g", "gr": "g",
+	"kilogram": "kg", "kilograms": "kg", "kg": "kg", "kgs": "kg",
+	"milligram": "mg", "milligrams": "mg", "mg": "mg",
+	"milliliter": "ml", "milliliters": "ml", "millilitre": "ml", "millilitres": "ml", "ml": "ml",
+	"centiliter": "cl", "centilitre": "cl", "cl": "cl", "deciliter": "dl", "decilitre": "dl", "dl": "dl",
+	"liter": "l", "liters": "l", "litre": "l", "litres": "l", "l": "l",
+	"pint": "pint", "pints": "pint", "pt": "pint",
+	"quart": "quart", "quarts": "quart", "qt": "quart",
+	"gallon": "gallon", "gallons": "gallon", "gal": "gallon",
+	"pinch": "pinch", "pinches": "pinch", "dash": "dash", "dashes": "dash",
+	"drop": "drop", "drops": "drop", "splash": "splash", "handful": "handful", "handfuls": "handful",
+	"bunch": "bunch", "bunches": "bunch", "sprig": "sprig", "sprigs": "sprig",
+	"clove": "clove", "cloves": "clove", "head": "head", "heads": "head", "stalk": "stalk", "stalks": "stalk",
+	"can": "can", "cans": "can", "tin": "can", "tins": "can", "jar": "jar", "jars": "jar",
+	"package": "package", "packages": "package", "pkg": "package", "packet": "packet", "packets": "packet",
+	"envelope": "envelope", "envelopes": "envelope", "bag": "bag", "bags": "bag", "box": "box", "boxes": "box",
+	"bottle": "bottle", "bottles": "bottle", "container": "container", "containers": "container",
+	"stick": "stick", "sticks": "stick", "slice": "slice", "slices": "slice", "piece": "piece", "pieces": "piece",
+	"sheet": "sheet", "sheets": "sheet",
+}
+
+// Units that convert into each other, in teaspoons and grams, so a second
+// amount such as "1 cup plus 2 tbsp" can be added to the first
+var (
+	volumeUnits = map[string]float64{
+		"tsp": 1, "tbsp": 3, "fl oz": 6, "cup": 48, "pint": 96, "quart": 192, "gallon": 768,
+		"ml": 0.202884, "cl": 2.02884, "dl": 20.2884, "l": 202.884,
+	}
+	weightUnits = map[string]float64{"mg": 0.001, "g": 1, "kg": 1000, "oz": 28.3495, "lb": 453.592}
+)
+
+// caseSensitiveUnits are abbreviations whose case matters: T is a tablespoon, t a teaspoon
+var caseSensitiveUnits = map[string]string{"T": "tbsp", "Tb": "tbsp", "t": "tsp"}
+
+// unitsNeedingName are units that are also ingredients: "2 cloves garlic" is
+// garlic, but "6 cloves" are cloves
+var unitsNeedingName = map[string]bool{"clove": true, "head": true, "stalk": true, "stick": true, "slice": true, "piece": true, "sheet": true}
+
+// Trailing phrases moved from the name to the notes
+var trailingNotes = []string{"to taste", "or to taste", "for serving", "for garnish", "to serve", "to garnish", "optional", "as needed", "divided", "plus more"}
+
+const quantityPattern = `\d+(?:\.\d+)?(?:\s+\d+/\d+|\s*[¼½¾⅐⅑⅒⅓⅔⅕⅖⅗⅘⅙⅚⅛⅜⅝⅞]|/\d+)?|[¼½¾⅐⅑⅒⅓⅔⅕⅖⅗⅘⅙⅚⅛⅜⅝⅞]`
+
+var (
+	leadingQuantityRegex = regexp.MustCompile(`^(` + quantityPattern + `)(?:\s*(?:-|to|or)\s*(` + quantityPattern + `))?(?:\s+|$|[^\d\s/.])`)
+	leadingSizeRegex     = regexp.MustCompile(`^((` + quantityPattern + `)\s*-\s*([A-Za-z]+)\.?)(?:\s+|$)`)
+	parenthesesRegex     = regexp.MustCompile(`\(([^()]*)\)|\[([^\[\]]*)\]`)
+)
+
+// ParseIngredient splits an ingredient line into quantity, unit, name,
+// alternates and notes. It never fails: anything it can't place is the name.
+func ParseIngredient(line string) Ingredient {
+	ing := Ingredient{Raw: line}
+	s := normaliseIngredient(line)
+
+	// Parenthesised text is an alternate amount or a note: "(200g)", "(optional)"
+	for _, m := range parenthesesRegex.FindAllStringSubmatch(s, -1) {
+		text := strings.TrimSpace(m[1] + m[2])
+		switch {
+		case text == "":
+		case isTrailingNote(text):
+			ing.Notes = joinNotes(ing.Notes, text)
+		default:
+			ing.Alternates = append(ing.Alternates, text)
+		}
+	}
+	s = strings.Join(strings.Fields(parenthesesRegex.ReplaceAllString(s, " ")), " ")
+
+	// Quantity: "2", "1.5", "1/2", "½", "1 ½", "1 1/2", "2-3", "2 to 3", "a", "one"
+	if m := leadingQuantityRegex.FindStringSubmatchIndex(s); m != nil && quantityEnds(s, m) {
+		ing.Quantity = parseQuantity(s[m[2]:m[3]])
+		ing.QuantityMax = ing.Quantity
+		end := m[3]
+		if m[4] >= 0 {
+			ing.QuantityMax = parseQuantity(s[m[4]:m[5]])
+			end = m[5]
+		}
+		s = strings.TrimSpace(s[end:])
+	} else if word, rest, ok := numberWord(s); ok {
+		ing.Quantity, ing.QuantityMax = word, word
+		s = rest
+	}
+
+	// A size run into its unit: "12-ounce package pasta", "2 8-ounce steaks"
+	if size, qty, unit, rest, ok := leadingSize(s); ok {
+		switch container, after, ok := leadingUnit(rest); {
+		case ok:
+			// The package is the unit and its size an alternate, as in "1 (12-ounce) package"
+			if ing.Quantity == 0 {
+				ing.Quantity, ing.QuantityMax = 1, 1
+			}
+			ing.Unit = container
+			ing.Alternates = append([]string{size}, ing.Alternates...)
+			rest = after
+		case ing.Quantity == 0:
+			ing.Quantity, ing.QuantityMax, ing.Unit = qty, qty, unit
+		default:
+			ing.Alternates = append([]string{size}, ing.Alternates...)
+		}
+		s = strings.TrimSpace(strings.TrimPrefix(rest, "of "))
+	}
+
+	// Unit, then an optional "of": "2 cups of flour", "200g flour", "a pinch of salt"
+	if ing.Unit == "" {
+		if unit, rest, ok := leadingUnit(s); ok {
+			ing.Unit = unit
+			s = strings.TrimSpace(strings.TrimPrefix(rest, "of "))
+		}
+	}
+
+	// A second amount added to the first: "1 cup plus 2 tbsp flour". It is
+	// converted when the units allow and otherwise kept as a note.
+	if rest, ok := strings.CutPrefix(s, "plus "); ok && ing.Unit != "" {
+		if qty, unit, after, ok := leadingMeasure(rest); ok {
+			if ratio, ok := unitRatio(unit, ing.Unit); ok {
+				ing.Quantity += qty * ratio
+				ing.QuantityMax += qty * ratio
+			} else {
+				ing.Notes = joinNotes(ing.Notes, "plus "+strings.TrimSpace(strings.TrimSuffix(rest, after)))
+			}
+			s = strings.TrimSpace(strings.TrimPrefix(after, "of "))
+		}
+	}
+
+	// Notes follow the first comma: "onion, finely chopped"
+	if name, notes, ok := strings.Cut(s, ","); ok {
+		s = strings.TrimSpace(name)
+		ing.Notes = joinNotes(strings.TrimSpace(notes), ing.Notes)
+	}
+	for changed := true; changed; {
+		changed = false
+		lower := strings.ToLower(s)
+		for _, note := range trailingNotes {
+			if strings.HasSuffix(lower, " "+note) {
+				ing.Notes = joinNotes(note, ing.Notes)
+				s = strings.TrimSpace(s[:len(s)-len(note)])
+				changed = true
+				break
+			}
+		}
+	}
+	ing.Name = s
+	return ing
+}
+
+// quantityEnds reports whether a matched quantity stands on its own: a number
+// run into letters must be run into a unit, as in "200g", and not "7up"
+func quantityEnds(s string, m []int) bool {
+	end := m[3]
+	if m[4] >= 0 {
+		end = m[5]
+	}
+	rest := s[end:]
+	if rest == "" || rest[0] == ' ' {
+		return true
+	}
+	_, _, ok := leadingUnit(rest)
+	return ok
+}
+
+// leadingSize reads a quantity joined to its unit by a hyphen, as in
+// "12-ounce", returning the text, the amount, the canonical unit and the rest
+func leadingSize(s string) (string, float64, string, string, bool) {
+	m := leadingSizeRegex.FindStringSubmatch(s)
+	if m == nil {
+		return "", 0, "", s, false
+	}
+	unit, ok := units[strings.ToLower(m[3])]
+	if !ok {
+		return "", 0, "", s, false
+	}
+	return m[1], parseQuantity(m[2]), unit, strings.TrimSpace(s[len(m[0]):]), true
+}
+
+// leadingMeasure reads a single amount and its unit, as in "2 tbsp flour"
+func leadingMeasure(s string) (float64, string, string, bool) {
+	m := leadingQuantityRegex.FindStringSubmatchIndex(s)
+	if m == nil || m[4] >= 0 || !quantityEnds(s, m) {
+		return 0, "", s, false
+	}
+	unit, rest, ok := leadingUnit(strings.TrimSpace(s[m[3]:]))
+	if !ok {
+		return 0, "", s, false
+	}
+	return parseQuantity(s[m[2]:m[3]]), unit, rest, true
+}
+
+// unitRatio returns how many of unit to make one of from, when both measure the same thing
+func unitRatio(from, to string) (float64, bool) {
+	for _, sizes := range []map[string]float64{volumeUnits, weightUnits} {
+		if f, ok := sizes[from]; ok {
+			if t, ok := sizes[to]; ok {
+				return f / t, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// normaliseIngredient evens out the ways quantities get typed: the fraction
+// slash, dashes, a number run into a fraction character ("1½") and spacing
+func normaliseIngredient(s string) string {
+	s = strings.NewReplacer("⁄", "/", "–", "-", "—", "-", " ", " ").Replace(s)
+	var b strings.Builder
+	prevDigit := false
+	for _, r := range s {
+		if _, ok := vulgarFractions[r]; ok && prevDigit {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(r)
+		prevDigit = r >= '0' && r <= '9'
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// parseQuantity reads one amount: a whole or decimal number, a fraction, a
+// fraction character, or a whole number followed by either
+func parseQuantity(s string) float64 {
+	total := 0.0
+	fields := strings.Fields(s)
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if r := []rune(f); len(r) == 1 {
+			if v, ok := vulgarFractions[r[0]]; ok {
+				total += v
+				continue
+			}
+		}
+		if num, den, ok := strings.Cut(f, "/"); ok {
+			n, err1 := strconv.ParseFloat(num, 64)
+			d, err2 := strconv.ParseFloat(den, 64)
+			if err1 == nil && err2 == nil && d != 0 {
+				total += n / d
+			}
+			continue
+		}
+		// A number run straight into a fraction character, e.g. "1½" before normalising
+		runes := []rune(f)
+		if v, ok := vulgarFractions[runes[len(runes)-1]]; ok && len(runes) > 1 {
+			n, _ := strconv.ParseFloat(string(runes[:len(runes)-1]), 64)
+			total += n + v
+			continue
+		}
+		n, _ := strconv.ParseFloat(f, 64)
+		total += n
+	}
+	return total
+}
+
+// numberWord reads an amount written as a word ("a", "one", "half", "a dozen")
+func numberWord(s string) (float64, string, bool) {
+	fields := strings.SplitN(s, " ", 3)
+	if len(fields) >= 3 {
+		if v, ok := numberWords[strings.ToLower(fields[0]+" "+fields[1])]; ok {
+			return v, fields[2], true
+		}
+	}
+	if len(fields) >= 2 {
+		if v, ok := numberWords[strings.ToLower(fields[0])]; ok {
+			return v, strings.Join(fields[1:], " "), true
+		}
+	}
+	return 0, s, false
+}
+
+// leadingUnit reads a unit at the start of s, trying two-word units first.
+// A unit must be followed by a name unless it is a plain measure.
+func leadingUnit(s string) (string, string, bool) {
+	fields := strings.SplitN(s, " ", 3)
+	clean := func(w string) string { return strings.TrimSuffix(w, ".") }
+
+	if len(fields) >= 2 {
+		two := strings.ToLower(clean(fields[0]) + " " + clean(fields[1]))
+		if unit, ok := units[two]; ok {
+			rest := ""
+			if len(fields) == 3 {
+				rest = fields[2]
+			}
+			return unit, rest, true
+		}
+	}
+	if len(fields) == 0 || fields[0] == "" {
+		return "", s, false
+	}
+	word := clean(fields[0])
+	unit, ok := caseSensitiveUnits[word]
+	if !ok {
+		unit, ok = units[strings.ToLower(word)]
+	}
+	if !ok {
+		return "", s, false
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(s, fields[0]))
+	if rest == "" && unitsNeedingName[unit] {
+		return "", s, false // "6 cloves": the cloves are the ingredient
+	}
+	return unit, rest, true
+}
+
+func isTrailingNote(text string) bool {
+	lower := strings.ToLower(text)
+	for _, note := range trailingNotes {
+		if lower == note {
+			return true
+		}
+	}
+	return false
+}
+
+func joinNotes(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return a + ", " + b
+}
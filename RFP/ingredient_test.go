@@ -0,0 +1,87 @@
+package rfp
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestParseIngredient(t *testing.T) {
+	tests := []struct {
+		line        string
+		quantity    float64
+		quantityMax float64
+		unit        string
+		name        string
+		alternates  []string
+		notes       string
+	}{
+		// Plain amounts
+		{"2 large eggs", 2, 2, "", "large eggs", nil, ""},
+		{"1 kg potatoes", 1, 1, "kg", "potatoes", nil, ""},
+		{"2 fl oz cream", 2, 2, "fl oz", "cream", nil, ""},
+		{"3 tbsp. butter, melted", 3, 3, "tbsp", "butter", nil, "melted"},
+		{"a pinch of salt", 1, 1, "pinch", "salt", nil, ""},
+		{"1 stick butter", 1, 1, "stick", "butter", nil, ""},
+
+		// Fractions
+		{"½ tsp salt", 0.5, 0.5, "tsp", "salt", nil, ""},
+		{"⅓ cup water", 1.0 / 3, 1.0 / 3, "cup", "water", nil, ""},
+		{"1½ cups sugar", 1.5, 1.5, "cup", "sugar", nil, ""},
+		{"1 ½ cups (200g) all-purpose flour, sifted", 1.5, 1.5, "cup", "all-purpose flour", []string{"200g"}, "sifted"},
+		{"1 1/2 cups milk", 1.5, 1.5, "cup", "milk", nil, ""},
+		{"1⁄2 cup cream", 0.5, 0.5, "cup", "cream", nil, ""},
+		{"Half an onion", 0.5, 0.5, "", "onion", nil, ""},
+
+		// Ranges
+		{"2-3 cloves garlic, minced", 2, 3, "clove", "garlic", nil, "minced"},
+		{"2 to 3 tablespoons olive oil", 2, 3, "tbsp", "olive oil", nil, ""},
+		{"1–2 tsp chilli flakes", 1, 2, "tsp", "chilli flakes", nil, ""},
+
+		// Units
+		{"1 T sugar", 1, 1, "tbsp", "sugar", nil, ""},
+		{"1 t vanilla", 1, 1, "tsp", "vanilla", nil, ""},
+		{"200g butter", 200, 200, "g", "butter", nil, ""},
+		{"6 cloves", 6, 6, "", "cloves", nil, ""},
+		{"2 cloves garlic", 2, 2, "clove", "garlic", nil, ""},
+		{"1 7up", 1, 1, "", "7up", nil, ""},
+
+		// Sizes and alternates
+		{"2 (14.5 ounce) cans diced tomatoes", 2, 2, "can", "diced tomatoes", []string{"14.5 ounce"}, ""},
+		{"1 (12-ounce) package pasta", 1, 1, "package", "pasta", []string{"12-ounce"}, ""},
+		{"12-ounce package pasta", 1, 1, "package", "pasta", []string{"12-ounce"}, ""},
+		{"2 8-ounce steaks", 2, 2, "", "steaks", []string{"8-ounce"}, ""},
+		{"8-ounce steak", 8, 8, "oz", "steak", nil, ""},
+
+		// Added amounts
+		{"1 cup plus 2 tbsp flour", 1.125, 1.125, "cup", "flour", nil, ""},
+		{"1 lb plus 4 oz beef", 1.25, 1.25, "lb", "beef", nil, ""},
+		{"1 cup plus 1 pinch salt", 1, 1, "cup", "salt", nil, "plus 1 pinch"},
+
+		// Notes
+		{"salt and pepper to taste", 0, 0, "", "salt and pepper", nil, "to taste"},
+		{"fresh basil leaves, for garnish (optional)", 0, 0, "", "fresh basil leaves", nil, "for garnish, optional"},
+	}
+
+	for _, tt := range tests {
+		got := ParseIngredient(tt.line)
+		if math.Abs(got.Quantity-tt.quantity) > 1e-9 || math.Abs(got.QuantityMax-tt.quantityMax) > 1e-9 {
+			t.Errorf("%q: quantity %v-%v, want %v-%v", tt.line, got.Quantity, got.QuantityMax, tt.quantity, tt.quantityMax)
+		}
+		if got.Unit != tt.unit {
+			t.Errorf("%q: unit %q, want %q", tt.line, got.Unit, tt.unit)
+		}
+		if got.Name != tt.name {
+			t.Errorf("%q: name %q, want %q", tt.line, got.Name, tt.name)
+		}
+		if !slices.Equal(got.Alternates, tt.alternates) {
+			t.Errorf("%q: alternates %q, want %q", tt.line, got.Alternates, tt.alternates)
+		}
+		if got.Notes != tt.notes {
+			t.Errorf("%q: notes %q, want %q", tt.line, got.Notes, tt.notes)
+		}
+		if got.Raw != tt.line {
+			t.Errorf("%q: raw %q", tt.line, got.Raw)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package rfp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/http"
+)
+
+var errCorruptImage = errors.New("corrupt image")
+
+// StripImageMetadata removes EXIF, XMP, IPTC and comment metadata from a JPEG,
+// PNG or WebP image without re-encoding it. Other formats are returned unchanged.
+func StripImageMetadata(data []byte) ([]byte, error) {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	}
+	return data, nil
+}
+
+// stripJPEG drops APP1 (EXIF/XMP), APP13 (IPTC) and COM segments.
+// Everything from the start-of-scan marker on is image data and copied as is.
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errCorruptImage
+	}
+	out := &bytes.Buffer{}
+	out.Write(data[:2]) // SOI
+
+	pos := 2
+	for {
+		if pos+4 > len(data) || data[pos] != 0xFF {
+			return nil, errCorruptImage
+		}
+		marker := data[pos+1]
+		if marker == 0xDA { // SOS
+			out.Write(data[pos:])
+			return out.Bytes(), nil
+		}
+		segLen := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + segLen
+		if segLen < 2 || end > len(data) {
+			return nil, errCorruptImage
+		}
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+}
+
+// stripPNG drops the eXIf chunk and the textual tEXt, zTXt and iTXt chunks
+func stripPNG(data []byte) ([]byte, error) {
+	if len(data) < 8 {
+		return nil, errCorruptImage
+	}
+	out := &bytes.Buffer{}
+	out.Write(data[:8]) // signature
+
+	pos := 8
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errCorruptImage
+		}
+		chunkLen := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		chunkType := string(data[pos+4 : pos+8])
+		end := pos + 12 + chunkLen // length + type + data + CRC
+		if chunkLen < 0 || end > len(data) {
+			return nil, errCorruptImage
+		}
+		switch chunkType {
+		case "eXIf", "tEXt", "zTXt", "iTXt":
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+	return out.Bytes(), nil
+}
+
+// stripWebP drops the EXIF and XMP chunks and clears their flags in the VP8X header
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 {
+		return nil, errCorruptImage
+	}
+	out := &bytes.Buffer{}
+	out.Write(data[:12]) // RIFF header; size patched below
+
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errCorruptImage
+		}
+		chunkType := string(data[pos : pos+4])
+		chunkLen := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		end := pos + 8 + chunkLen + chunkLen%2 // chunks are padded to even length
+		if chunkLen < 0 || end > len(data) {
+			return nil, errCorruptImage
+		}
+		switch chunkType {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			if chunkLen < 1 {
+				return nil, errCorruptImage
+			}
+			start := out.Len()
+			out.Write(data[pos:end])
+			out.Bytes()[start+8] &^= 0x08 | 0x04 // EXIF and XMP present flags
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:8], uint32(len(result)-8))
+	return result, nil
+}
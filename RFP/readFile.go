@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // readChunk reads a single chunk from the buffer
@@ -34,11 +35,16 @@ func ReadRecipeFile(path, filename string) (*Recipe, error) {
 	if err != nil {
 		return nil, err
 	}
+	return DecodeRecipe(data)
+}
+
+// DecodeRecipe parses the contents of an RFP3 file into a Recipe struct
+func DecodeRecipe(data []byte) (*Recipe, error) {
 	buf := bytes.NewReader(data)
 
 	// Check magic
 	magic := make([]byte, 4)
-	if _, err = buf.Read(magic); err != nil {
+	if _, err := buf.Read(magic); err != nil {
 		return nil, err
 	}
 	if string(magic) != "RFP3" {
@@ -92,6 +98,16 @@ func ReadRecipeFile(path, filename string) (*Recipe, error) {
 			rdr.Read(nameBytes)
 			recipe.Name = string(nameBytes)
 
+		case "TIME":
+			var secs [4]uint32
+			binary.Read(rdr, binary.LittleEndian, &secs)
+			recipe.times = &Times{
+				Prep:       time.Duration(secs[0]) * time.Second,
+				Cook:       time.Duration(secs[1]) * time.Second,
+				Additional: time.Duration(secs[2]) * time.Second,
+				Total:      time.Duration(secs[3]) * time.Second,
+			}
+
 		case "INGR":
 			var strLen uint16
 			binary.Read(rdr, binary.LittleEndian, &strLen)
@@ -1,5 +1,13 @@
 package rfp
 
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
 // Recipe stores essential information needed for rendering
 type Recipe struct {
 	Name        string
@@ -7,6 +15,26 @@ type Recipe struct {
 	CoreProps   map[string]string // e.g. {"Prep Time": "15 mins", "Servings": "6"}
 	Ingredients []string
 	Steps       []string
+
+	times *Times // from the file's TIME chunk; nil until the recipe has been saved with one
+}
+
+// Prop returns a core property by name, ignoring case, so "Prep Time" typed
+// at the CLI and "prep time" written by the scrapers are the same property
+func (r *Recipe) Prop(key string) string {
+	return lookupProp(r.CoreProps, key)
+}
+
+func lookupProp(props map[string]string, key string) string {
+	if v, ok := props[key]; ok {
+		return v
+	}
+	for k, v := range props {
+		if strings.EqualFold(strings.TrimSpace(k), key) {
+			return v
+		}
+	}
+	return ""
 }
 
 func NewRecipe() *Recipe {
@@ -16,3 +44,77 @@ func NewRecipe() *Recipe {
 		Steps:       []string{},
 	}
 }
+
+// ImageURLPrefix is where the API and web servers serve the image directory
+const ImageURLPrefix = "/images/"
+
+// ImageURL returns the public URL for a recipe's ImagePath. Images on the
+// server are exposed under ImageURLPrefix by file name; external URLs pass through.
+func ImageURL(imagePath string) string {
+	if imagePath == "" || strings.HasPrefix(imagePath, "http://") || strings.HasPrefix(imagePath, "https://") {
+		return imagePath
+	}
+	// Older scrapes stored Windows-style paths such as `images/\Name`
+	name := filepath.Base(strings.ReplaceAll(imagePath, `\`, "/"))
+	return ImageURLPrefix + url.PathEscape(name)
+}
+
+// ImagePathFromURL is the inverse of ImageURL: it maps a public image URL back to
+// the name stored in ImagePath. Any ?size= query is dropped.
+func ImagePathFromURL(imageURL string) string {
+	if !strings.HasPrefix(imageURL, ImageURLPrefix) {
+		return imageURL
+	}
+	name, _, _ := strings.Cut(strings.TrimPrefix(imageURL, ImageURLPrefix), "?")
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return name
+}
+
+// Minutes is Times in whole minutes, as the API returns it
+type Minutes struct {
+	Prep       int `json:",omitempty"`
+	Cook       int `json:",omitempty"`
+	Additional int `json:",omitempty"`
+	Total      int `json:",omitempty"`
+}
+
+// Minutes rounds each time to the minute
+func (t Times) Minutes() Minutes {
+	m := func(d time.Duration) int { return int(d.Round(time.Minute) / time.Minute) }
+	return Minutes{Prep: m(t.Prep), Cook: m(t.Cook), Additional: m(t.Additional), Total: m(t.Total)}
+}
+
+// MarshalJSON exposes the image as ImageURL, so API clients never see where
+// the server keeps it on disk, and adds the times parsed from CoreProps as Minutes
+func (r Recipe) MarshalJSON() ([]byte, error) {
+	type plain Recipe
+	minutes := r.Times().Minutes()
+	aux := struct {
+		plain
+		ImagePath string   `json:",omitempty"` // shadows plain.ImagePath; always empty
+		ImageURL  string   `json:",omitempty"`
+		Minutes   *Minutes `json:",omitempty"`
+	}{plain: plain(r), ImageURL: ImageURL(r.ImagePath)}
+	if minutes != (Minutes{}) {
+		aux.Minutes = &minutes
+	}
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON accepts the ImageURL produced by MarshalJSON as well as a bare ImagePath
+func (r *Recipe) UnmarshalJSON(data []byte) error {
+	type plain Recipe
+	aux := struct {
+		*plain
+		ImageURL string
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.ImageURL != "" {
+		r.ImagePath = ImagePathFromURL(aux.ImageURL)
+	}
+	return nil
+}
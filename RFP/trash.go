@@ -0,0 +1,274 @@
+package rfp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ErrRecipeExists is returned when restoring would overwrite a live recipe
+var ErrRecipeExists = errors.New("a recipe with that ID already exists")
+
+const trashEntryFile = "entry.json"
+
+// TrashEntry describes a deleted recipe waiting in the trash.
+// Each entry is a directory holding the .rfp, its image (if any) and this metadata.
+type TrashEntry struct {
+	TrashID   string    `json:"trash_id"`             // directory name inside the trash
+	ID        string    `json:"id"`                   // recipe ID before deletion
+	Name      string    `json:"name"`                 // recipe.Name from the file
+	ImagePath string    `json:"image_path,omitempty"` // original image location, if the image was moved
+	ImageFile string    `json:"image_file,omitempty"` // image filename inside the entry directory
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// TrashDir returns the configured trash directory, falling back to "trash/"
+// for configs written before the trash existed
+func TrashDir(cfg *Config) string {
+	if cfg.TrashPath == "" {
+		return "trash/"
+	}
+	return cfg.TrashPath
+}
+
+// MoveToTrash moves a recipe and its image into a new trash entry
+func MoveToTrash(cfg *Config, id string) (*TrashEntry, error) {
+	recipe, err := ReadRecipeFile(cfg.DefaultRecipePath, id+".rfp")
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entry := &TrashEntry{
+		TrashID:   id + "-" + strconv.FormatInt(now.UnixNano(), 10),
+		ID:        id,
+		Name:      recipe.Name,
+		DeletedAt: now,
+	}
+	entryDir := filepath.Join(TrashDir(cfg), entry.TrashID)
+	if err := os.MkdirAll(entryDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create trash entry: %v", err)
+	}
+
+	recipePath := filepath.Join(cfg.DefaultRecipePath, id+".rfp")
+	if err := os.Rename(recipePath, filepath.Join(entryDir, id+".rfp")); err != nil {
+		os.RemoveAll(entryDir)
+		return nil, fmt.Errorf("failed to move recipe to trash: %v", err)
+	}
+
+	// The image is best effort: a missing image must not block the delete.
+	// Images in the content-addressed store may be shared and are left for the image GC.
+	// Older images are only taken from inside the image directory, and copied
+	// rather than moved while another recipe still shows them.
+	moved := false
+	if !IsImageRef(recipe.ImagePath) {
+		if imagePath := ImageFilePath(cfg, recipe.ImagePath); imagePath != "" {
+			imageFile := "image" + filepath.Ext(imagePath)
+			dst := filepath.Join(entryDir, imageFile)
+			if imageShared(cfg, imagePath) {
+				err = copyFile(imagePath, dst)
+			} else {
+				err = os.Rename(imagePath, dst)
+				moved = err == nil
+			}
+			if err == nil {
+				entry.ImagePath = imagePath
+				entry.ImageFile = imageFile
+			}
+		}
+	}
+
+	// Without its metadata the entry wouldn't be listed, so put everything back
+	if err := writeTrashEntry(entryDir, entry); err != nil {
+		if moved {
+			os.Rename(filepath.Join(entryDir, entry.ImageFile), entry.ImagePath)
+		}
+		if renameErr := os.Rename(filepath.Join(entryDir, id+".rfp"), recipePath); renameErr == nil {
+			os.RemoveAll(entryDir)
+		}
+		return nil, err
+	}
+	return entry, nil
+}
+
+// imageShared reports whether any recipe left in the recipe directory or the
+// trash uses the image file at imagePath. A recipe that can't be read counts
+// as using it.
+func imageShared(cfg *Config, imagePath string) bool {
+	uses := func(dir, name string) bool {
+		recipe, err := ReadRecipeFile(dir, name)
+		return err != nil || ImageFilePath(cfg, recipe.ImagePath) == imagePath
+	}
+
+	files, err := os.ReadDir(cfg.DefaultRecipePath)
+	if err != nil {
+		return true
+	}
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".rfp" && uses(cfg.DefaultRecipePath, file.Name()) {
+			return true
+		}
+	}
+	entries, err := ListTrash(cfg)
+	if err != nil {
+		return true
+	}
+	for _, entry := range entries {
+		if uses(filepath.Join(TrashDir(cfg), entry.TrashID), entry.ID+".rfp") {
+			return true
+		}
+	}
+	return false
+}
+
+// copyFile copies the file at src to a new file at dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// ListTrash returns all trash entries, most recently deleted first
+func ListTrash(cfg *Config) ([]TrashEntry, error) {
+	dirs, err := os.ReadDir(TrashDir(cfg))
+	if os.IsNotExist(err) {
+		return []TrashEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []TrashEntry{}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		entry, err := readTrashEntry(filepath.Join(TrashDir(cfg), dir.Name()))
+		if err != nil {
+			continue // skip half-written entries
+		}
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].DeletedAt.After(entries[j].DeletedAt)
+	})
+	return entries, nil
+}
+
+// RestoreFromTrash moves a trashed recipe and its image back into place.
+// It returns the restored recipe ID, or ErrRecipeExists if that ID is taken again.
+func RestoreFromTrash(cfg *Config, trashID string) (string, error) {
+	if trashID != filepath.Base(trashID) {
+		return "", fmt.Errorf("invalid trash ID")
+	}
+	entryDir := filepath.Join(TrashDir(cfg), trashID)
+	entry, err := readTrashEntry(entryDir)
+	if err != nil {
+		return "", err
+	}
+
+	recipePath := filepath.Join(cfg.DefaultRecipePath, entry.ID+".rfp")
+	if _, err := os.Stat(recipePath); err == nil {
+		return "", ErrRecipeExists
+	}
+	if err := os.Rename(filepath.Join(entryDir, entry.ID+".rfp"), recipePath); err != nil {
+		return "", fmt.Errorf("failed to restore recipe: %v", err)
+	}
+
+	if entry.ImageFile != "" {
+		// Only the file name is trusted, so the image always goes back into the image directory
+		imagePath := filepath.Join(cfg.DefaultImagePath, filepath.Base(entry.ImagePath))
+		if _, err := os.Stat(imagePath); os.IsNotExist(err) {
+			os.MkdirAll(cfg.DefaultImagePath, 0755)
+			os.Rename(filepath.Join(entryDir, entry.ImageFile), imagePath)
+		}
+	}
+
+	return entry.ID, os.RemoveAll(entryDir)
+}
+
+// PurgeTrash permanently removes entries deleted more than olderThan ago and
+// takes their recipes out of any collections, unless the ID is in use again by
+// a live recipe or another trash entry. An olderThan of zero empties the whole
+// trash. It returns the number of entries removed.
+func PurgeTrash(cfg *Config, olderThan time.Duration) (int, error) {
+	entries, err := ListTrash(cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	purged := 0
+	gone := make(map[string]bool)
+	kept := make(map[string]bool) // IDs still in the trash
+	for i, entry := range entries {
+		if olderThan > 0 && entry.DeletedAt.After(cutoff) {
+			kept[entry.ID] = true
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(TrashDir(cfg), entry.TrashID)); err != nil {
+			for _, rest := range entries[i:] {
+				kept[rest.ID] = true
+			}
+			return purged, errors.Join(err, forgetPurged(cfg, gone, kept))
+		}
+		gone[entry.ID] = true
+		purged++
+	}
+	return purged, forgetPurged(cfg, gone, kept)
+}
+
+// forgetPurged removes purged recipe IDs from the collections unless a live
+// recipe or a trash entry still uses them
+func forgetPurged(cfg *Config, gone, kept map[string]bool) error {
+	for id := range gone {
+		if _, err := os.Stat(filepath.Join(cfg.DefaultRecipePath, id+".rfp")); err == nil || kept[id] {
+			delete(gone, id)
+		}
+	}
+	if len(gone) == 0 {
+		return nil
+	}
+	return forgetRecipes(cfg, gone)
+}
+
+func writeTrashEntry(entryDir string, entry *TrashEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal trash entry: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(entryDir, trashEntryFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write trash entry: %v", err)
+	}
+	return nil
+}
+
+func readTrashEntry(entryDir string) (*TrashEntry, error) {
+	data, err := os.ReadFile(filepath.Join(entryDir, trashEntryFile))
+	if err != nil {
+		return nil, err
+	}
+	var entry TrashEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
@@ -0,0 +1,153 @@
+package rfp
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Resized copies of stored images are cached in a subdirectory of the image
+// store as "<hash>-<size><ext>". They are derived data: deleting the directory
+// only costs regenerating them on the next request.
+const variantDir = "variants"
+
+// ImageSizes maps variant names accepted by the image endpoint to their maximum width
+var ImageSizes = map[string]int{
+	"thumbnail": 200,
+	"medium":    600,
+	"large":     1200,
+}
+
+// maxVariantPixels caps the size of images decoded for resizing. Decoding
+// allocates the whole bitmap, so a small file claiming huge dimensions could
+// otherwise use gigabytes of memory.
+const maxVariantPixels = 50_000_000
+
+// ImageVariantPath returns the path of a resized variant of the stored image ref,
+// generating and caching it first if needed. Images the standard library cannot
+// decode, images larger than maxVariantPixels, and images already narrower than
+// the variant are returned unchanged.
+func ImageVariantPath(dir, ref, size string) (string, error) {
+	original := filepath.Join(dir, ref)
+	if size == "" {
+		return original, nil
+	}
+	width, ok := ImageSizes[size]
+	if !ok {
+		return "", fmt.Errorf("unknown image size %q", size)
+	}
+
+	ext := filepath.Ext(ref)
+	variant := filepath.Join(dir, variantDir, strings.TrimSuffix(ref, ext)+"-"+size+ext)
+	if _, err := os.Stat(variant); err == nil {
+		return variant, nil
+	}
+
+	f, err := os.Open(original)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// Check the header's dimensions before decoding the pixels
+	config, _, err := image.DecodeConfig(f)
+	if err != nil || config.Width <= width || int64(config.Width)*int64(config.Height) > maxVariantPixels {
+		return original, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	src, format, err := image.Decode(f)
+	if err != nil || src.Bounds().Dx() <= width {
+		return original, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(variant), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(variant), ".variant-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %v", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	resized := resizeImage(src, width)
+	switch format {
+	case "png":
+		err = png.Encode(tmp, resized)
+	case "gif":
+		err = gif.Encode(tmp, resized, nil)
+	default:
+		err = jpeg.Encode(tmp, resized, &jpeg.Options{Quality: 85})
+	}
+	tmp.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode image: %v", err)
+	}
+
+	// Rename so concurrent requests never serve a half-written variant
+	if err := os.Rename(tmp.Name(), variant); err != nil {
+		return "", fmt.Errorf("failed to save image: %v", err)
+	}
+	return variant, nil
+}
+
+// GenerateImageVariants creates every size variant of a stored image ref
+func GenerateImageVariants(dir, ref string) error {
+	for size := range ImageSizes {
+		if _, err := ImageVariantPath(dir, ref, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeImageVariants deletes the cached variants of a stored image ref
+func removeImageVariants(dir, ref string) {
+	ext := filepath.Ext(ref)
+	for size := range ImageSizes {
+		os.Remove(filepath.Join(dir, variantDir, strings.TrimSuffix(ref, ext)+"-"+size+ext))
+	}
+}
+
+// resizeImage scales src down to the given width, keeping its aspect ratio.
+// Each destination pixel is the average of the source pixels it covers (a box
+// filter), which is plenty for downscaling photos.
+func resizeImage(src image.Image, width int) image.Image {
+	b := src.Bounds()
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy0 := b.Min.Y + y*b.Dy()/height
+		sy1 := max(b.Min.Y+(y+1)*b.Dy()/height, sy0+1)
+		for x := 0; x < width; x++ {
+			sx0 := b.Min.X + x*b.Dx()/width
+			sx1 := max(b.Min.X+(x+1)*b.Dx()/width, sx0+1)
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					bl += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
@@ -7,6 +7,8 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
+	"time"
 )
 
 // writeChunk creates a chunk to the buffer with 8-byte alignment
@@ -28,6 +30,11 @@ func writeChunk(buf *bytes.Buffer, chunkType string, payload []byte) error {
 
 // WriteRecipe writes a Recipe struct into a binary RFP file
 func WriteRecipe(dir, filename string, r Recipe) error {
+	return os.WriteFile(filepath.Join(dir, RecipeID(filename)+".rfp"), EncodeRecipe(r), 0644)
+}
+
+// EncodeRecipe returns the binary RFP3 encoding of a Recipe struct
+func EncodeRecipe(r Recipe) []byte {
 	buf := &bytes.Buffer{}
 
 	// --- HEADER ---
@@ -65,6 +72,17 @@ func WriteRecipe(dir, filename string, r Recipe) error {
 	writeChunk(buf, "CORE", corePayload.Bytes())
 	chunkCount++
 
+	// --- TIME CHUNK ---
+	// Prep, cook, additional and total time in seconds, parsed from CoreProps
+	// so they always match the text
+	times := parseTimes(r.CoreProps)
+	timePayload := &bytes.Buffer{}
+	for _, d := range []time.Duration{times.Prep, times.Cook, times.Additional, times.Total} {
+		binary.Write(timePayload, binary.LittleEndian, uint32(d/time.Second))
+	}
+	writeChunk(buf, "TIME", timePayload.Bytes())
+	chunkCount++
+
 	// --- INGREDIENT CHUNKS ---
 	for _, ing := range r.Ingredients {
 		ingPayload := &bytes.Buffer{}
@@ -87,10 +105,16 @@ func WriteRecipe(dir, filename string, r Recipe) error {
 	// --- PATCH CHUNK COUNT IN HEADER ---
 	data := buf.Bytes()
 	binary.LittleEndian.PutUint32(data[0x08:], uint32(chunkCount))
+	return data
+}
 
-	// --- WRITE FILE ---
-	var nonAlphanumericRegex = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+var nonAlphanumericRegex = regexp.MustCompile(`[^a-zA-Z0-9]+`)
 
-	filename = nonAlphanumericRegex.ReplaceAllString(filename, "")
-	return os.WriteFile(filepath.Join(dir, filename+".rfp"), data, 0644)
+// RecipeID returns the ID a recipe is stored under for the given name or filename.
+// A trailing .rfp is dropped and everything but letters and digits is stripped,
+// so "chicken_tikka.rfp" and "Chicken Tikka" map to "chickentikka" and "ChickenTikka".
+// It is the one canonical recipe ID: every write goes through it.
+func RecipeID(filename string) string {
+	filename = strings.TrimSuffix(filename, ".rfp")
+	return nonAlphanumericRegex.ReplaceAllString(filename, "")
 }
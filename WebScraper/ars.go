@@ -1,14 +1,12 @@
 package ars
 
 import (
-	"errors"
+	"bytes"
+	"context"
 	"fmt"
-	"net/http"
+	"net/url"
 	"strings"
-
-	"io"
-	"os"
-	"path/filepath"
+	"sync"
 
 	rfp "github.com/CaptSniper/RecipeServer/RFP"
 	"github.com/PuerkitoBio/goquery"
@@ -21,45 +19,100 @@ type Ingredient struct {
 	Name     string
 }
 
-func ScrapeRecipe(url, imagePath string) (*rfp.Recipe, error) {
-	if strings.Contains(url, "allrecipes.com") {
-		return ScrapeAllRecipes(url, imagePath)
-	} else {
-		err := errors.New("unsupported base website")
-		return nil, err
-	}
+// ScrapeRecipe scrapes a recipe page with DefaultRegistry, saving its image
+// into imagePath. Sites without their own scraper are read from the
+// schema.org data most recipe sites embed, or failing that by heuristics.
+func ScrapeRecipe(ctx context.Context, url, imagePath string) (*ScrapeResult, error) {
+	return DefaultRegistry.Scrape(ctx, url, imagePath)
 }
 
-// ScrapeAllRecipes fetches a URL from AllRecipes and extracts structured recipe data
-func ScrapeAllRecipes(url, imagePath string) (*rfp.Recipe, error) {
+// ScrapeRecipeHTML runs the same scrapers over a page's HTML, e.g. a saved
+// page or one behind a login. baseURL, if given, is where the page came from.
+func ScrapeRecipeHTML(ctx context.Context, html []byte, baseURL, imagePath string) (*ScrapeResult, error) {
+	return DefaultRegistry.ScrapeHTML(ctx, html, baseURL, imagePath)
+}
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch URL: %v", err)
+// pageCacheKey holds a *pageCache in the context of one Registry.Scrape call,
+// so fallback scrapers reuse the page instead of downloading it again
+type pageCacheKey struct{}
+
+type pageCache struct {
+	mu      sync.Mutex
+	pages   map[string][]byte
+	offline bool // scraping supplied HTML: never go to the network
+}
+
+func withPageCache(ctx context.Context, cache *pageCache) context.Context {
+	return context.WithValue(ctx, pageCacheKey{}, cache)
+}
+
+// fetchDocument downloads and parses an HTML page
+func fetchDocument(ctx context.Context, url string) (*goquery.Document, error) {
+	cache, _ := ctx.Value(pageCacheKey{}).(*pageCache)
+	if cache != nil {
+		cache.mu.Lock()
+		body, ok := cache.pages[url]
+		cache.mu.Unlock()
+		if ok {
+			return parseDocument(body)
+		}
+		if cache.offline {
+			return nil, fmt.Errorf("%s is not available offline", url)
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("bad status code: %d", resp.StatusCode)
+	body, err := DefaultClient().GetPage(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	if cache != nil {
+		cache.mu.Lock()
+		cache.pages[url] = body
+		cache.mu.Unlock()
 	}
+	return parseDocument(body)
+}
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+func parseDocument(body []byte) (*goquery.Document, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse HTML: %v", err)
 	}
+	return doc, nil
+}
+
+// allRecipesScraper reads AllRecipes pages with selectors for their layout
+type allRecipesScraper struct{}
+
+var allRecipesDomains = []string{"allrecipes.com"}
+
+func (allRecipesScraper) Name() string      { return "allrecipes" }
+func (allRecipesScraper) Domains() []string { return allRecipesDomains }
+
+func (allRecipesScraper) CanHandle(u *url.URL) bool {
+	return matchesAnyHost(u, allRecipesDomains)
+}
+
+// Scrape fetches a URL from AllRecipes and extracts structured recipe data
+func (allRecipesScraper) Scrape(ctx context.Context, pageURL string) (*rfp.Recipe, error) {
+	doc, err := fetchDocument(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
 
 	data := rfp.NewRecipe()
 
 	recipeName := strings.TrimSpace(doc.Find("div#article-header--recipe_1-0 h1").First().Text())
+	if recipeName == "" {
+		// The layout changed; let the next scraper try
+		return nil, fmt.Errorf("page layout not recognised")
+	}
 	data.Name = recipeName
 
 	// --- 1. Image ---
-	doc.Find("div#photo-dialog__item_1-0 img").Each(func(i int, s *goquery.Selection) {
-		if src, exists := s.Attr("src"); exists && src != "" {
-			DownloadImage(src, imagePath, data.Name)
-			data.ImagePath = imagePath + "\\" + data.Name
-		}
-	})
+	if src, exists := doc.Find("div#photo-dialog__item_1-0 img").First().Attr("src"); exists && src != "" {
+		data.ImagePath = resolveURL(pageURL, src)
+	}
 
 	// --- 2. Times & Servings ---
 	doc.Find("div#mm-recipes-details_1-0 div.mm-recipes-details__item").Each(func(i int, s *goquery.Selection) {
@@ -90,7 +143,21 @@ func ScrapeAllRecipes(url, imagePath string) (*rfp.Recipe, error) {
 			Name:     strings.TrimSpace(spans.Eq(2).Text()),
 		}
 
-		data.Ingredients = append(data.Ingredients, ing.Quantity+" "+ing.Unit+" "+ing.Name)
+		// Without the three spans, keep the line as written; rfp.ParseIngredient
+		// can split it when needed
+		line := cleanText(p.Text())
+		if ing.Name != "" {
+			var parts []string
+			for _, part := range []string{ing.Quantity, ing.Unit, ing.Name} {
+				if part != "" {
+					parts = append(parts, part)
+				}
+			}
+			line = strings.Join(parts, " ")
+		}
+		if line != "" {
+			data.Ingredients = append(data.Ingredients, line)
+		}
 	})
 
 	// --- 4. Steps / Directions ---
@@ -104,52 +171,16 @@ func ScrapeAllRecipes(url, imagePath string) (*rfp.Recipe, error) {
 	return data, nil
 }
 
-// DownloadImage downloads an image from the given URL and saves it to the specified directory.
-// It returns the full path to the saved image.
-func DownloadImage(url, saveDir, saveName string) (string, error) {
+// DownloadImage downloads an image from the given URL into the content-addressed
+// image store at saveDir. It returns the image ref to keep in Recipe.ImagePath.
+func DownloadImage(ctx context.Context, url, saveDir string) (string, error) {
 	if url == "" {
 		return "", fmt.Errorf("empty image URL")
 	}
 
-	// Ensure the save directory exists
-	if _, err := os.Stat(saveDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(saveDir, 0755); err != nil {
-			return "", fmt.Errorf("failed to create directory: %v", err)
-		}
-	}
-
-	// Extract the filename from the URL
-	tokens := strings.Split(url, "/")
-	filename := tokens[len(tokens)-1]
-	if filename == "" {
-		filename = saveName + ".jpg"
-	}
-
-	savePath := filepath.Join(saveDir, filename)
-
-	// Download the image
-	resp, err := http.Get(url)
+	body, err := DefaultClient().GetImage(ctx, url)
 	if err != nil {
-		return "", fmt.Errorf("failed to download image: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("bad status code: %d", resp.StatusCode)
+		return "", fmt.Errorf("failed to download image: %w", err)
 	}
-
-	// Create the file
-	out, err := os.Create(savePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create file: %v", err)
-	}
-	defer out.Close()
-
-	// Copy the data
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to save image: %v", err)
-	}
-
-	return savePath, nil
+	return rfp.StoreImage(saveDir, bytes.NewReader(body))
 }
@@ -0,0 +1,246 @@
+package ars
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	rfp "github.com/CaptSniper/RecipeServer/RFP"
+)
+
+// Every page and image the scrapers download goes through one Client, so a
+// slow or hostile site can't hang a request or fill memory: each attempt has
+// a deadline, bodies are capped, and 429/5xx responses are retried with
+// exponential backoff until the caller's context gives up.
+
+// ClientOptions configures a Client. Zero fields take the defaults below,
+// except MaxRetries, where zero means no retries.
+type ClientOptions struct {
+	ConnectTimeout time.Duration // dialling and the TLS handshake
+	ReadTimeout    time.Duration // one attempt, from sending the request to the end of the body
+	UserAgent      string
+	MaxPageBytes   int64
+	MaxImageBytes  int64
+	MaxRetries     int           // retries after the first attempt
+	RetryBackoff   time.Duration // wait before the first retry, doubling after each
+	MaxBackoff     time.Duration // longest wait, including a server's Retry-After
+	Egress         EgressPolicy
+}
+
+const (
+	defaultConnectTimeout = 10 * time.Second
+	defaultReadTimeout    = 30 * time.Second
+	defaultUserAgent      = "RecipeServer/1.0 (+https://github.com/CaptSniper/RecipeServer)"
+	defaultMaxPageBytes   = 5 << 20
+	defaultMaxImageBytes  = 10 << 20
+	defaultMaxRetries     = 2
+	defaultRetryBackoff   = 500 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+	maxRedirects          = 10
+)
+
+// ErrTooLarge is returned when a response is bigger than the configured limit
+var ErrTooLarge = errors.New("response too large")
+
+// Client fetches pages and images for the scrapers
+type Client struct {
+	opts ClientOptions
+	http *http.Client
+}
+
+// NewClient returns a Client with opts, filling in defaults
+func NewClient(opts ClientOptions) *Client {
+	if opts.ConnectTimeout <= 0 {
+		opts.ConnectTimeout = defaultConnectTimeout
+	}
+	if opts.ReadTimeout <= 0 {
+		opts.ReadTimeout = defaultReadTimeout
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = defaultUserAgent
+	}
+	if opts.MaxPageBytes <= 0 {
+		opts.MaxPageBytes = defaultMaxPageBytes
+	}
+	if opts.MaxImageBytes <= 0 {
+		opts.MaxImageBytes = defaultMaxImageBytes
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = defaultRetryBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+
+	// No proxy: the egress policy can only check addresses it dials itself
+	dialer := &net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: 30 * time.Second}
+	transport := &http.Transport{
+		DialContext:           opts.Egress.dialContext(dialer),
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		ResponseHeaderTimeout: opts.ReadTimeout,
+		MaxIdleConns:          20,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	checkRedirect := func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return opts.Egress.CheckURL(req.URL)
+	}
+	return &Client{opts: opts, http: &http.Client{Transport: transport, CheckRedirect: checkRedirect}}
+}
+
+// CheckURL reports whether the egress policy allows fetching u
+func (c *Client) CheckURL(u *url.URL) error {
+	return c.opts.Egress.CheckURL(u)
+}
+
+// ClientOptionsFromConfig reads the scraper settings from the config
+func ClientOptionsFromConfig(cfg *rfp.Config) ClientOptions {
+	return ClientOptions{
+		ConnectTimeout: time.Duration(cfg.ScrapeDialTimeoutSeconds) * time.Second,
+		ReadTimeout:    time.Duration(cfg.ScrapeTimeoutSeconds) * time.Second,
+		UserAgent:      cfg.ScrapeUserAgent,
+		MaxPageBytes:   int64(cfg.ScrapeMaxPageMB) << 20,
+		MaxImageBytes:  int64(cfg.ScrapeMaxImageMB) << 20,
+		MaxRetries:     cfg.ScrapeMaxRetries,
+		Egress:         EgressPolicy{AllowHosts: cfg.ScrapeAllowHosts, DenyHosts: cfg.ScrapeDenyHosts},
+	}
+}
+
+var (
+	clientMu      sync.RWMutex
+	defaultClient = NewClient(ClientOptions{MaxRetries: defaultMaxRetries})
+)
+
+// Configure replaces the client the scrapers use with one built from cfg
+func Configure(cfg *rfp.Config) {
+	SetClient(NewClient(ClientOptionsFromConfig(cfg)))
+}
+
+// SetClient replaces the client the scrapers use
+func SetClient(c *Client) {
+	clientMu.Lock()
+	defaultClient = c
+	clientMu.Unlock()
+}
+
+// DefaultClient returns the client the scrapers use
+func DefaultClient() *Client {
+	clientMu.RLock()
+	defer clientMu.RUnlock()
+	return defaultClient
+}
+
+// GetPage downloads an HTML page, up to MaxPageBytes
+func (c *Client) GetPage(ctx context.Context, url string) ([]byte, error) {
+	return c.get(ctx, url, "text/html,application/xhtml+xml;q=0.9,*/*;q=0.8", c.opts.MaxPageBytes)
+}
+
+// GetImage downloads an image, up to MaxImageBytes
+func (c *Client) GetImage(ctx context.Context, url string) ([]byte, error) {
+	return c.get(ctx, url, "image/*", c.opts.MaxImageBytes)
+}
+
+// get fetches url, retrying 429 and 5xx responses with exponential backoff
+func (c *Client) get(ctx context.Context, rawURL, accept string, maxBytes int64) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.CheckURL(u); err != nil {
+		return nil, err
+	}
+	backoff := c.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		body, retryAfter, err := c.attempt(ctx, rawURL, accept, maxBytes)
+		if err == nil || retryAfter < 0 || attempt >= c.opts.MaxRetries {
+			return body, err
+		}
+
+		wait := backoff
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if wait > c.opts.MaxBackoff {
+			wait = c.opts.MaxBackoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w (gave up retrying: %v)", err, ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// attempt makes one request. retryAfter is negative when the error is not
+// worth retrying, and otherwise how long the server asked us to wait, if at all.
+func (c *Client) attempt(ctx context.Context, rawURL, accept string, maxBytes int64) (body []byte, retryAfter time.Duration, err error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.ReadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, -1, err
+	}
+	req.Header.Set("User-Agent", c.opts.UserAgent)
+	req.Header.Set("Accept", accept)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if ctx.Err() == context.DeadlineExceeded || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return nil, 0, err // a slow attempt may go faster next time
+		}
+		return nil, -1, err // the caller gave up, or the host can't be reached
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("bad status code: %d", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, -1, fmt.Errorf("bad status code: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxBytes {
+		return nil, -1, fmt.Errorf("%w: %d bytes, limit is %d", ErrTooLarge, resp.ContentLength, maxBytes)
+	}
+
+	body, err = io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, -1, fmt.Errorf("%w: limit is %d bytes", ErrTooLarge, maxBytes)
+	}
+	return body, 0, nil
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as a date
+func parseRetryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(h); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
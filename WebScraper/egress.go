@@ -0,0 +1,155 @@
+package ars
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// The scraper fetches URLs chosen by API clients and by the pages it reads,
+// so it must not become a way into the server's own network. Every address is
+// checked as it is dialled, after DNS resolution, so a hostname that resolves
+// (or later re-resolves) to a private address is caught too; redirects are
+// dialled the same way.
+
+// ErrBlocked is returned for a URL the egress policy doesn't allow
+var ErrBlocked = errors.New("destination not allowed")
+
+// EgressPolicy decides which URLs the scraper may fetch. Only http and https
+// are allowed, and never loopback, private, link-local or other non-public
+// addresses. Entries in either list are hostnames, matching subdomains too,
+// IP addresses or CIDR ranges.
+type EgressPolicy struct {
+	AllowHosts []string // exempt from the non-public address check, e.g. a recipe site on the LAN
+	DenyHosts  []string // always refused, even if also allowed
+}
+
+// blockedPrefixes are non-public ranges the netip predicates don't cover
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, which can reach IPv4 ranges above
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// IsPublicIP reports whether ip is an ordinary internet address
+func IsPublicIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL refuses URLs that aren't http or https, name a denied host, or
+// name a non-public IP address directly. Hostnames are checked again once
+// resolved, when they are dialled.
+func (p EgressPolicy) CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: only http and https URLs can be scraped", ErrBlocked)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("%w: URL has no host", ErrBlocked)
+	}
+	if p.denies(host, netip.Addr{}) {
+		return fmt.Errorf("%w: %s is on the deny list", ErrBlocked, host)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !IsPublicIP(ip) && !p.allows(host, ip) {
+		return fmt.Errorf("%w: %s is not a public address", ErrBlocked, host)
+	}
+	return nil
+}
+
+// checkDial is called with each resolved address before connecting
+func (p EgressPolicy) checkDial(host, address string) error {
+	ipText, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(ipText)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if p.denies(host, ip) {
+		return fmt.Errorf("%w: %s (%s) is on the deny list", ErrBlocked, host, ip)
+	}
+	if !IsPublicIP(ip) && !p.allows(host, ip) {
+		return fmt.Errorf("%w: %s resolves to %s, which is not a public address", ErrBlocked, host, ip)
+	}
+	return nil
+}
+
+// dialContext wraps dial so every connection is checked against the policy.
+// The check runs in the dialer's Control hook, on the address actually being
+// connected to, so DNS can't change the answer between checking and dialling.
+func (p EgressPolicy) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		d := *dialer
+		d.Control = func(_, address string, _ syscall.RawConn) error {
+			return p.checkDial(host, address)
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+}
+
+func (p EgressPolicy) allows(host string, ip netip.Addr) bool {
+	return matchesHostList(p.AllowHosts, host, ip)
+}
+
+func (p EgressPolicy) denies(host string, ip netip.Addr) bool {
+	return matchesHostList(p.DenyHosts, host, ip)
+}
+
+// matchesHostList reports whether host or ip is covered by any entry: a
+// hostname (and its subdomains), an IP address or a CIDR range
+func matchesHostList(list []string, host string, ip netip.Addr) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if hostIP, err := netip.ParseAddr(host); err == nil && !ip.IsValid() {
+		ip = hostIP.Unmap()
+	}
+	for _, entry := range list {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case strings.Contains(entry, "/"):
+			if prefix, err := netip.ParsePrefix(entry); err == nil && ip.IsValid() && prefix.Contains(ip) {
+				return true
+			}
+		default:
+			if entryIP, err := netip.ParseAddr(entry); err == nil {
+				if ip.IsValid() && entryIP.Unmap() == ip {
+					return true
+				}
+				continue
+			}
+			entry = strings.TrimPrefix(strings.TrimSuffix(entry, "."), "*.")
+			if host == entry || strings.HasSuffix(host, "."+entry) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package ars
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	rfp "github.com/CaptSniper/RecipeServer/RFP"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// The heuristic scraper reads pages with no structured data the way a person
+// skims them: the ingredients are the list whose lines start with quantities
+// and units, the method is the list of long lines full of cooking verbs. It
+// always reports a confidence so the UI can ask for a review.
+
+var (
+	// A quantity at the start of a line: 2, 1/2, ½, 1-2, 1½, "a", "one" ...
+	leadingQuantityRegex = regexp.MustCompile(`(?i)^(\d+([.,/]\d+)?|[¼½¾⅓⅔⅛⅜⅝⅞]|a|an|one|two|three|four|five|six|half|a few|several|pinch|dash)([\s\-–]|$|[¼½¾⅓⅔⅛⅜⅝⅞])`)
+	unitRegex            = regexp.MustCompile(`(?i)\b(cups?|tbsps?|tablespoons?|tsps?|teaspoons?|oz|ounces?|lbs?|pounds?|g|grams?|kg|ml|l|liters?|litres?|pinch|dash|cloves?|cans?|packages?|sticks?|slices?|bunch|handful|sprigs?|quarts?|pints?)\b`)
+	cookingVerbRegex     = regexp.MustCompile(`(?i)\b(preheat|heat|bake|roast|boil|simmer|stir|mix|whisk|beat|fold|combine|add|pour|cook|fry|saute|sauté|chop|slice|dice|season|serve|place|remove|transfer|cover|drain|blend|knead|grill|melt|spread|sprinkle|toss|let|bring|reduce|set aside)\b`)
+	ingredientHeading    = regexp.MustCompile(`(?i)ingredient`)
+	methodHeading        = regexp.MustCompile(`(?i)instruction|direction|method|preparation|steps`)
+	timeTextRegex        = regexp.MustCompile(`(?i)\b(prep|cook|total|additional)(?:ing)?\s+time\s*:?\s*((?:\d+\s*(?:days?|hours?|hrs?|minutes?|mins?)\s*)+)`)
+	servingsTextRegex    = regexp.MustCompile(`(?i)\b(?:serves|servings|yield)\s*:?\s*(\d+(?:\s*-\s*\d+)?)`)
+)
+
+// maxHeuristicConfidence keeps a guess below the 1 that structured data gets,
+// so a guessed recipe is always offered for review
+const maxHeuristicConfidence = 0.9
+
+// heuristicScraper is the last resort, for pages with no structured data at all
+type heuristicScraper struct{}
+
+func (heuristicScraper) Name() string              { return "heuristic" }
+func (heuristicScraper) Domains() []string         { return nil }
+func (heuristicScraper) CanHandle(u *url.URL) bool { return true }
+
+func (h heuristicScraper) Scrape(ctx context.Context, pageURL string) (*rfp.Recipe, error) {
+	recipe, _, err := h.ScrapeScored(ctx, pageURL)
+	return recipe, err
+}
+
+// ScrapeScored fetches a page and guesses at the recipe in it
+func (heuristicScraper) ScrapeScored(ctx context.Context, pageURL string) (*rfp.Recipe, float64, error) {
+	doc, err := fetchDocument(ctx, pageURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ExtractHeuristic(doc, pageURL)
+}
+
+// candidate is a block of lines that might be the ingredients or the method
+type candidate struct {
+	sel     *goquery.Selection
+	lines   []string
+	score   float64
+	heading bool // introduced by a heading such as "Ingredients"
+}
+
+// ExtractHeuristic guesses a recipe from an unstructured page and returns it
+// with a confidence between 0 and 1. It fails only if it finds neither
+// ingredients nor instructions.
+func ExtractHeuristic(doc *goquery.Document, pageURL string) (*rfp.Recipe, float64, error) {
+	doc.Find("script, style, noscript, nav, header, footer, aside, form, iframe").Remove()
+
+	ingredients := bestCandidate(doc, ingredientScore, ingredientHeading)
+	steps := bestCandidate(doc, methodScore, methodHeading)
+	if ingredients != nil && steps != nil && ingredients.sel.IsSelection(steps.sel) {
+		steps = nil // the same list can't be both
+	}
+	if ingredients == nil && steps == nil {
+		return nil, 0, fmt.Errorf("no recipe found in page")
+	}
+
+	data := rfp.NewRecipe()
+	data.Name = pageTitle(doc)
+	if src, ok := doc.Find(`meta[property="og:image"]`).First().Attr("content"); ok && src != "" {
+		data.ImagePath = resolveURL(pageURL, src)
+	}
+	if pageURL != "" {
+		data.CoreProps["source"] = pageURL
+	}
+	text := cleanText(doc.Find("body").Text())
+	for _, m := range timeTextRegex.FindAllStringSubmatch(text, -1) {
+		key := strings.ToLower(m[1]) + " time"
+		if _, ok := data.CoreProps[key]; !ok {
+			data.CoreProps[key] = strings.TrimSpace(m[2])
+		}
+	}
+	if m := servingsTextRegex.FindStringSubmatch(text); m != nil {
+		data.CoreProps["servings"] = m[1]
+	}
+
+	// Confidence: up to 0.45 for the ingredients, 0.35 for the method, 0.1 for
+	// a name, and 0.1 when both blocks sit under the headings you'd expect
+	confidence := 0.0
+	if ingredients != nil {
+		data.Ingredients = ingredients.lines
+		confidence += 0.45 * min(ingredients.score/4, 1)
+	}
+	if steps != nil {
+		data.Steps = steps.lines
+		confidence += 0.35 * min(steps.score/3, 1)
+	}
+	if data.Name != "" {
+		confidence += 0.1
+	} else {
+		data.Name = "Untitled recipe"
+	}
+	if ingredients != nil && ingredients.heading && steps != nil && steps.heading {
+		confidence += 0.1
+	}
+	return data, min(confidence, maxHeuristicConfidence), nil
+}
+
+// bestCandidate scores every list on the page, and runs of paragraphs under a
+// matching heading, returning the highest scoring block or nil
+func bestCandidate(doc *goquery.Document, score func([]string) float64, heading *regexp.Regexp) *candidate {
+	var best *candidate
+	consider := func(sel *goquery.Selection, lines []string) {
+		if len(lines) < 2 {
+			return
+		}
+		c := &candidate{sel: sel, lines: lines, score: score(lines)}
+		if h := precedingHeading(sel); h != "" && heading.MatchString(h) {
+			c.heading = true
+			c.score *= 1.5
+		}
+		if c.score > 0 && (best == nil || c.score > best.score) {
+			best = c
+		}
+	}
+
+	doc.Find("ul, ol").Each(func(i int, list *goquery.Selection) {
+		var lines []string
+		list.ChildrenFiltered("li").Each(func(i int, li *goquery.Selection) {
+			if line := cleanText(li.Text()); line != "" {
+				lines = append(lines, line)
+			}
+		})
+		consider(list, lines)
+	})
+
+	// Paragraphs between a matching heading and the next heading
+	doc.Find("h1, h2, h3, h4, h5, h6").Each(func(i int, h *goquery.Selection) {
+		if !heading.MatchString(h.Text()) {
+			return
+		}
+		var lines []string
+		block := h.NextUntil("h1, h2, h3, h4, h5, h6")
+		block.Filter("p").Each(func(i int, p *goquery.Selection) {
+			if line := cleanText(p.Text()); line != "" {
+				lines = append(lines, line)
+			}
+		})
+		consider(block.Filter("p"), lines)
+	})
+
+	return best
+}
+
+// ingredientScore rewards lists of short lines that start with a quantity or
+// mention a unit. A list that is mostly something else scores 0.
+func ingredientScore(lines []string) float64 {
+	matches := 0
+	for _, line := range lines {
+		if len(line) > 120 {
+			continue
+		}
+		if leadingQuantityRegex.MatchString(line) || unitRegex.MatchString(line) {
+			matches++
+		}
+	}
+	ratio := float64(matches) / float64(len(lines))
+	if ratio < 0.5 {
+		return 0
+	}
+	return ratio * float64(matches)
+}
+
+// methodScore rewards lists of sentences that mostly contain cooking verbs
+func methodScore(lines []string) float64 {
+	matches, chars := 0, 0
+	for _, line := range lines {
+		chars += len(line)
+		if cookingVerbRegex.MatchString(line) {
+			matches++
+		}
+	}
+	ratio := float64(matches) / float64(len(lines))
+	if ratio < 0.5 || chars/len(lines) < 25 {
+		return 0 // navigation and ingredient lists are short
+	}
+	return ratio * float64(matches)
+}
+
+// precedingHeading finds the text of the nearest heading before sel, looking
+// at earlier siblings of sel and of its ancestors
+func precedingHeading(sel *goquery.Selection) string {
+	for s := sel.First(); s.Length() > 0 && !s.Is("body"); s = s.Parent() {
+		if h := s.PrevAllFiltered("h1, h2, h3, h4, h5, h6").First(); h.Length() > 0 {
+			return h.Text()
+		}
+		if h := s.PrevAll().Find("h1, h2, h3, h4, h5, h6").Last(); h.Length() > 0 {
+			return h.Text()
+		}
+	}
+	return ""
+}
+
+// pageTitle prefers the Open Graph title, then the first h1, then <title>
+// without a trailing " | Site Name"
+func pageTitle(doc *goquery.Document) string {
+	if t, ok := doc.Find(`meta[property="og:title"]`).First().Attr("content"); ok && cleanText(t) != "" {
+		return cleanText(t)
+	}
+	if t := cleanText(doc.Find("h1").First().Text()); t != "" {
+		return t
+	}
+	t := cleanText(doc.Find("title").First().Text())
+	for _, sep := range []string{" | ", " - ", " – ", " — "} {
+		if i := strings.LastIndex(t, sep); i > 0 {
+			t = t[:i]
+		}
+	}
+	return t
+}
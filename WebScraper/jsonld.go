@@ -0,0 +1,332 @@
+package ars
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	rfp "github.com/CaptSniper/RecipeServer/RFP"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Most recipe sites embed a schema.org Recipe for search engines, usually as
+// JSON-LD and on older sites as microdata or RDFa attributes (see microdata.go),
+// so reading it works on sites nobody has written a scraper for.
+// See https://schema.org/Recipe
+
+var tagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// schemaOrgScraper is the fallback for every site: it reads the page's
+// schema.org Recipe from JSON-LD, or failing that from microdata or RDFa
+type schemaOrgScraper struct{}
+
+func (schemaOrgScraper) Name() string              { return "schema.org" }
+func (schemaOrgScraper) Domains() []string         { return nil }
+func (schemaOrgScraper) CanHandle(u *url.URL) bool { return true }
+
+// Scrape fetches a page and extracts the schema.org Recipe embedded in it
+func (schemaOrgScraper) Scrape(ctx context.Context, pageURL string) (*rfp.Recipe, error) {
+	doc, err := fetchDocument(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	return ExtractSchemaOrg(doc, pageURL)
+}
+
+// ExtractSchemaOrg extracts the page's schema.org Recipe, preferring JSON-LD
+// and falling back to microdata and then RDFa
+func ExtractSchemaOrg(doc *goquery.Document, pageURL string) (*rfp.Recipe, error) {
+	recipe, err := ExtractJSONLD(doc, pageURL)
+	if err == nil {
+		return recipe, nil
+	}
+	if recipe, mdErr := ExtractMicrodata(doc, pageURL); mdErr == nil {
+		return recipe, nil
+	}
+	return nil, err
+}
+
+// ExtractJSONLD maps the first schema.org Recipe found in the document's JSON-LD
+// onto a Recipe. ImagePath is left as the image's absolute URL; pageURL resolves relative links.
+func ExtractJSONLD(doc *goquery.Document, pageURL string) (*rfp.Recipe, error) {
+	node := findJSONLDRecipe(doc)
+	if node == nil {
+		return nil, fmt.Errorf("no schema.org Recipe found in page")
+	}
+	return recipeFromSchema(node, pageURL)
+}
+
+// recipeFromSchema maps a schema.org Recipe, decoded as JSON-LD would be, onto a Recipe
+func recipeFromSchema(node map[string]any, pageURL string) (*rfp.Recipe, error) {
+	data := rfp.NewRecipe()
+	data.Name = cleanText(ldString(node["name"]))
+	if data.Name == "" {
+		return nil, fmt.Errorf("schema.org Recipe has no name")
+	}
+
+	if src := ldImage(node["image"]); src != "" {
+		data.ImagePath = resolveURL(pageURL, src)
+	}
+
+	for prop, key := range map[string]string{"prepTime": "prep time", "cookTime": "cook time", "totalTime": "total time"} {
+		if d := durationText(ldString(node[prop])); d != "" {
+			data.CoreProps[key] = d
+		}
+	}
+	if servings := ldYield(node["recipeYield"]); servings != "" {
+		data.CoreProps["servings"] = servings
+	}
+	for prop, key := range map[string]string{"recipeCategory": "category", "recipeCuisine": "cuisine"} {
+		if values := ldStrings(node[prop]); len(values) > 0 {
+			data.CoreProps[key] = cleanText(strings.Join(values, ", "))
+		}
+	}
+	if author := ldName(node["author"]); author != "" {
+		data.CoreProps["author"] = author
+	}
+	if pageURL != "" {
+		data.CoreProps["source"] = pageURL
+	}
+
+	ingredients := node["recipeIngredient"]
+	if ingredients == nil {
+		ingredients = node["ingredients"] // pre-2017 name, still seen in the wild
+	}
+	if ingredients == nil {
+		ingredients = node["ingredient"] // Google's retired data-vocabulary.org markup
+	}
+	for _, ing := range ldStrings(ingredients) {
+		if ing = cleanText(ing); ing != "" {
+			data.Ingredients = append(data.Ingredients, ing)
+		}
+	}
+	instructions := node["recipeInstructions"]
+	if instructions == nil {
+		instructions = node["instructions"] // data-vocabulary.org
+	}
+	data.Steps = ldInstructions(instructions)
+
+	return data, nil
+}
+
+// findJSONLDRecipe returns the first Recipe node in any JSON-LD block
+func findJSONLDRecipe(doc *goquery.Document) map[string]any {
+	var found map[string]any
+	doc.Find("script").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if typ, _ := s.Attr("type"); !strings.HasPrefix(strings.ToLower(strings.TrimSpace(typ)), "application/ld+json") {
+			return true
+		}
+		var v any
+		text := s.Text()
+		if err := json.Unmarshal([]byte(text), &v); err != nil {
+			// Hand-written JSON-LD often has raw line breaks inside strings
+			if err := json.Unmarshal([]byte(strings.NewReplacer("\n", " ", "\r", " ", "\t", " ").Replace(text)), &v); err != nil {
+				return true
+			}
+		}
+		found = findRecipeNode(v)
+		return found == nil
+	})
+	return found
+}
+
+// findRecipeNode searches a JSON-LD value depth first for an object typed Recipe,
+// which may sit at the top level, in an array, in @graph or under mainEntity
+func findRecipeNode(v any) map[string]any {
+	switch v := v.(type) {
+	case map[string]any:
+		if isRecipeType(v["@type"]) {
+			return v
+		}
+		for _, child := range v {
+			if node := findRecipeNode(child); node != nil {
+				return node
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if node := findRecipeNode(child); node != nil {
+				return node
+			}
+		}
+	}
+	return nil
+}
+
+// isRecipeType accepts "Recipe", "schema:Recipe", "https://schema.org/Recipe"
+// and arrays containing any of them
+func isRecipeType(t any) bool {
+	for _, s := range ldStrings(t) {
+		if s == "Recipe" || strings.HasSuffix(s, ":Recipe") || strings.HasSuffix(s, "/Recipe") {
+			return true
+		}
+	}
+	return false
+}
+
+// ldString reads a text value, which may also be a number or a one-element array
+func ldString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		if len(v) > 0 {
+			return ldString(v[0])
+		}
+	}
+	return ""
+}
+
+// ldStrings reads a value that may be a single string or an array of them
+func ldStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var out []string
+		for _, item := range v {
+			if s := ldString(item); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// ldName reads a Person or Organization (or several) as display names
+func ldName(v any) string {
+	switch v := v.(type) {
+	case string:
+		return cleanText(v)
+	case map[string]any:
+		return cleanText(ldString(v["name"]))
+	case []any:
+		var names []string
+		for _, item := range v {
+			if name := ldName(item); name != "" {
+				names = append(names, name)
+			}
+		}
+		return strings.Join(names, ", ")
+	}
+	return ""
+}
+
+// ldImage picks an image URL from a URL, an ImageObject or an array of either
+func ldImage(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case map[string]any:
+		if u := ldString(v["url"]); u != "" {
+			return u
+		}
+		return ldString(v["contentUrl"])
+	case []any:
+		for _, item := range v {
+			if u := ldImage(item); u != "" {
+				return u
+			}
+		}
+	}
+	return ""
+}
+
+// ldYield prefers a yield with words ("4 servings") over a bare count, since
+// sites often list both
+func ldYield(v any) string {
+	values := ldStrings(v)
+	for _, y := range values {
+		if _, err := strconv.Atoi(strings.TrimSpace(y)); err != nil {
+			return cleanText(y)
+		}
+	}
+	if len(values) > 0 {
+		return cleanText(values[0])
+	}
+	return ""
+}
+
+// ldInstructions flattens recipeInstructions into steps. It may be one block of
+// text, a list of strings, HowToSteps, or HowToSections of steps; a named
+// section becomes a "Name:" heading line before its steps.
+func ldInstructions(v any) []string {
+	steps := []string{}
+	switch v := v.(type) {
+	case string:
+		for _, line := range strings.Split(tagRegex.ReplaceAllString(strings.ReplaceAll(v, "<br", "\n<br"), "\n"), "\n") {
+			if line = cleanText(line); line != "" {
+				steps = append(steps, line)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			steps = append(steps, ldInstructions(item)...)
+		}
+	case map[string]any:
+		if items, ok := v["itemListElement"]; ok {
+			// HowToSection, or an ItemList of steps
+			if name := cleanText(ldString(v["name"])); name != "" && isType(v["@type"], "HowToSection") {
+				steps = append(steps, strings.TrimSuffix(name, ":")+":")
+			}
+			return append(steps, ldInstructions(items)...)
+		}
+		text := cleanText(ldString(v["text"]))
+		if text == "" {
+			text = cleanText(ldString(v["name"]))
+		}
+		if text != "" {
+			steps = append(steps, text)
+		}
+	}
+	return steps
+}
+
+func isType(t any, want string) bool {
+	for _, s := range ldStrings(t) {
+		if s == want || strings.HasSuffix(s, ":"+want) || strings.HasSuffix(s, "/"+want) {
+			return true
+		}
+	}
+	return false
+}
+
+// durationText turns an ISO 8601 duration such as "PT1H30M" into the
+// "1 hr 30 mins" form the AllRecipes scraper stores. Other text passes through.
+func durationText(d string) string {
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(d)), "P") {
+		return cleanText(d)
+	}
+	parsed, ok := rfp.ParseDuration(d)
+	if !ok {
+		return cleanText(d)
+	}
+	return rfp.FormatDuration(parsed)
+}
+
+// cleanText decodes HTML entities, drops tags and collapses whitespace
+func cleanText(s string) string {
+	s = html.UnescapeString(tagRegex.ReplaceAllString(s, " "))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// resolveURL makes ref absolute relative to the page it came from
+func resolveURL(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
@@ -0,0 +1,184 @@
+package ars
+
+import (
+	"fmt"
+	"strings"
+
+	rfp "github.com/CaptSniper/RecipeServer/RFP"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// Microdata (itemscope/itemtype/itemprop) and RDFa (typeof/property) put the
+// same schema.org vocabulary in HTML attributes. Both are read into the map
+// shape decoded JSON-LD has, so recipeFromSchema maps all three formats.
+
+// markup names the attributes one of the two formats uses
+type markup struct {
+	isItem   func(s *goquery.Selection) bool
+	itemType string // attribute holding the item's type
+	prop     string // attribute naming the property an element holds
+}
+
+var (
+	microdata = markup{
+		isItem:   func(s *goquery.Selection) bool { _, ok := s.Attr("itemscope"); return ok },
+		itemType: "itemtype",
+		prop:     "itemprop",
+	}
+	rdfa = markup{
+		isItem:   func(s *goquery.Selection) bool { _, ok := s.Attr("typeof"); return ok },
+		itemType: "typeof",
+		prop:     "property",
+	}
+)
+
+// Elements whose text starts a new line, so a list of steps stays a list
+var blockElements = map[string]bool{
+	"p": true, "li": true, "br": true, "div": true, "tr": true, "section": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// ExtractMicrodata maps the first schema.org Recipe marked up with microdata,
+// or else RDFa, onto a Recipe. ImagePath is left as the image's absolute URL.
+func ExtractMicrodata(doc *goquery.Document, pageURL string) (*rfp.Recipe, error) {
+	for _, m := range []markup{microdata, rdfa} {
+		var node map[string]any
+		doc.Find("[" + m.itemType + "]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+			if !m.isItem(s) || !isRecipeType(itemTypes(s, m)) {
+				return true
+			}
+			node = readItem(s, m)
+			return false
+		})
+		if node != nil {
+			return recipeFromSchema(node, pageURL)
+		}
+	}
+	return nil, fmt.Errorf("no schema.org Recipe microdata or RDFa found in page")
+}
+
+// itemTypes returns an item's types; both formats allow several, space separated
+func itemTypes(s *goquery.Selection, m markup) any {
+	types := []any{}
+	for _, t := range strings.Fields(s.AttrOr(m.itemType, "")) {
+		types = append(types, t)
+	}
+	return types
+}
+
+// readItem collects an item's properties. A property whose element is itself an
+// item (a HowToStep, an author) becomes a nested map; properties seen more than
+// once become arrays, as in JSON-LD.
+func readItem(item *goquery.Selection, m markup) map[string]any {
+	node := map[string]any{"@type": itemTypes(item, m)}
+
+	var walk func(children *goquery.Selection)
+	walk = func(children *goquery.Selection) {
+		children.Each(func(i int, el *goquery.Selection) {
+			isItem := m.isItem(el)
+			if names := strings.Fields(el.AttrOr(m.prop, "")); len(names) > 0 {
+				var value any
+				if isItem {
+					value = readItem(el, m)
+				} else {
+					value = propertyValue(el)
+				}
+				for _, name := range names {
+					addProperty(node, propertyName(name), value)
+				}
+			}
+			// Properties inside a nested item belong to that item
+			if !isItem {
+				walk(el.Children())
+			}
+		})
+	}
+	walk(item.Children())
+	return node
+}
+
+// propertyName strips a vocabulary prefix: "schema:name" and
+// "https://schema.org/name" are both "name"
+func propertyName(name string) string {
+	if i := strings.LastIndexAny(name, ":/"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+func addProperty(node map[string]any, name string, value any) {
+	switch existing := node[name].(type) {
+	case nil:
+		node[name] = value
+	case []any:
+		node[name] = append(existing, value)
+	default:
+		node[name] = []any{existing, value}
+	}
+}
+
+// propertyValue reads a property from the attribute the element type keeps it
+// in (the microdata rules, plus RDFa's content and resource), falling back to
+// its text
+func propertyValue(el *goquery.Selection) string {
+	if content, ok := el.Attr("content"); ok {
+		return content
+	}
+	var attr string
+	switch goquery.NodeName(el) {
+	case "meta":
+		attr = "content"
+	case "img", "audio", "video", "source", "embed", "iframe", "track":
+		attr = "src"
+	case "a", "area", "link":
+		attr = "href"
+	case "object":
+		attr = "data"
+	case "data", "meter":
+		attr = "value"
+	case "time":
+		attr = "datetime"
+	}
+	if attr != "" {
+		if v, ok := el.Attr(attr); ok {
+			return v
+		}
+	}
+	if v, ok := el.Attr("resource"); ok {
+		return v
+	}
+	return blockText(el)
+}
+
+// blockText is the element's text with a line break at each block element, so
+// instructions written as a list or paragraphs split into steps
+func blockText(el *goquery.Selection) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+		case html.ElementNode:
+			if n.Data == "script" || n.Data == "style" {
+				return
+			}
+			if blockElements[n.Data] {
+				b.WriteString("\n")
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type == html.ElementNode && blockElements[n.Data] {
+			b.WriteString("\n")
+		}
+	}
+	for _, n := range el.Nodes {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,260 @@
+package ars
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	rfp "github.com/CaptSniper/RecipeServer/RFP"
+)
+
+// Scraper extracts a recipe from pages it knows how to read. Scrapers leave a
+// remote image URL in ImagePath; the registry downloads it into the image store.
+type Scraper interface {
+	// Name identifies the scraper in listings and errors
+	Name() string
+	// Domains lists the sites the scraper is written for, or none if it is generic
+	Domains() []string
+	CanHandle(u *url.URL) bool
+	Scrape(ctx context.Context, pageURL string) (*rfp.Recipe, error)
+}
+
+// ScoredScraper is implemented by scrapers that guess, and say how sure they
+// are. Scrapers that don't implement it are taken as fully confident.
+type ScoredScraper interface {
+	Scraper
+	// ScrapeScored is Scrape plus a confidence between 0 and 1
+	ScrapeScored(ctx context.Context, pageURL string) (*rfp.Recipe, float64, error)
+}
+
+// ScrapeResult is a scraped recipe with the scraper that produced it and how
+// confident that scraper is. Anything below 1 deserves a review before saving.
+type ScrapeResult struct {
+	Recipe     *rfp.Recipe
+	Scraper    string
+	Confidence float64
+}
+
+// MarshalJSON encodes the recipe as usual with "Scraper" and "Confidence" added
+// alongside its fields, so clients expecting a plain recipe keep working
+func (r ScrapeResult) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(r.Recipe)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	fields["Scraper"] = r.Scraper
+	fields["Confidence"] = r.Confidence
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON reads what MarshalJSON writes
+func (r *ScrapeResult) UnmarshalJSON(data []byte) error {
+	var aux struct {
+		Scraper    string
+		Confidence float64
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	recipe := rfp.NewRecipe()
+	if err := json.Unmarshal(data, recipe); err != nil {
+		return err
+	}
+	r.Recipe, r.Scraper, r.Confidence = recipe, aux.Scraper, aux.Confidence
+	return nil
+}
+
+// SiteInfo describes a registered scraper for GET /scrape
+type SiteInfo struct {
+	Name     string   `json:"name"`
+	Domains  []string `json:"domains"`
+	Priority int      `json:"priority"`
+	Generic  bool     `json:"generic"`
+}
+
+// Priorities used by the built-in scrapers. Site scrapers outrank the generic
+// fallbacks so hand-written selectors win where they exist.
+const (
+	PrioritySite      = 100
+	PriorityFallback  = 0
+	PriorityHeuristic = -100
+)
+
+type registration struct {
+	scraper  Scraper
+	priority int
+}
+
+// Registry holds scrapers and picks which to use for a URL
+type Registry struct {
+	mu       sync.RWMutex
+	scrapers []registration
+}
+
+// DefaultRegistry holds the built-in scrapers and is used by ScrapeRecipe
+var DefaultRegistry = NewRegistry()
+
+func init() {
+	DefaultRegistry.Register(allRecipesScraper{}, PrioritySite)
+	DefaultRegistry.Register(schemaOrgScraper{}, PriorityFallback)
+	DefaultRegistry.Register(heuristicScraper{}, PriorityHeuristic)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a scraper. Higher priorities are tried first; equal priorities
+// keep registration order.
+func (r *Registry) Register(s Scraper, priority int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scrapers = append(r.scrapers, registration{scraper: s, priority: priority})
+	sort.SliceStable(r.scrapers, func(i, j int) bool {
+		return r.scrapers[i].priority > r.scrapers[j].priority
+	})
+}
+
+// Sites lists the registered scrapers in the order they are tried
+func (r *Registry) Sites() []SiteInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sites := []SiteInfo{}
+	for _, reg := range r.scrapers {
+		domains := reg.scraper.Domains()
+		if domains == nil {
+			domains = []string{}
+		}
+		sites = append(sites, SiteInfo{
+			Name:     reg.scraper.Name(),
+			Domains:  domains,
+			Priority: reg.priority,
+			Generic:  len(domains) == 0,
+		})
+	}
+	return sites
+}
+
+// Lookup returns the scrapers that can handle u, best first
+func (r *Registry) Lookup(u *url.URL) []Scraper {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var matches []Scraper
+	for _, reg := range r.scrapers {
+		if reg.scraper.CanHandle(u) {
+			matches = append(matches, reg.scraper)
+		}
+	}
+	return matches
+}
+
+// Scrape tries each scraper that can handle pageURL in priority order and
+// returns the first recipe found. The page is downloaded once however many
+// scrapers try it. The recipe's image is downloaded into imagePath; an image
+// that can't be downloaded is dropped.
+func (r *Registry) Scrape(ctx context.Context, pageURL, imagePath string) (*ScrapeResult, error) {
+	u, err := parsePageURL(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := DefaultClient().CheckURL(u); err != nil {
+		return nil, err
+	}
+	cache := &pageCache{pages: make(map[string][]byte)}
+	return r.scrape(withPageCache(ctx, cache), u, pageURL, imagePath)
+}
+
+// ScrapeHTML is Scrape for HTML that is already at hand; nothing but the
+// recipe's image is downloaded. baseURL is optional: it resolves relative
+// links such as the image, and picks a site scraper as if the page had been
+// fetched from there.
+func (r *Registry) ScrapeHTML(ctx context.Context, html []byte, baseURL, imagePath string) (*ScrapeResult, error) {
+	u := &url.URL{}
+	if baseURL != "" {
+		var err error
+		if u, err = parsePageURL(baseURL); err != nil {
+			return nil, fmt.Errorf("invalid base URL: must be an absolute http or https URL")
+		}
+	}
+	cache := &pageCache{pages: map[string][]byte{baseURL: html}, offline: true}
+	return r.scrape(withPageCache(ctx, cache), u, baseURL, imagePath)
+}
+
+func parsePageURL(pageURL string) (*url.URL, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL: must be an absolute http or https URL")
+	}
+	return u, nil
+}
+
+func (r *Registry) scrape(ctx context.Context, u *url.URL, pageURL, imagePath string) (*ScrapeResult, error) {
+	scrapers := r.Lookup(u)
+	if len(scrapers) == 0 {
+		return nil, fmt.Errorf("unsupported base website")
+	}
+
+	var failures []string
+	var blocked []error // failures caused by the egress policy
+	for _, s := range scrapers {
+		var recipe *rfp.Recipe
+		var err error
+		confidence := 1.0
+		if scored, ok := s.(ScoredScraper); ok {
+			recipe, confidence, err = scored.ScrapeScored(ctx, pageURL)
+		} else {
+			recipe, err = s.Scrape(ctx, pageURL)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if errors.Is(err, ErrBlocked) {
+				blocked = append(blocked, err)
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", s.Name(), err))
+			continue
+		}
+		if recipe.ImagePath != "" {
+			ref, err := DownloadImage(ctx, recipe.ImagePath, imagePath)
+			if err != nil {
+				ref = ""
+			}
+			recipe.ImagePath = ref
+		}
+		return &ScrapeResult{Recipe: recipe, Scraper: s.Name(), Confidence: confidence}, nil
+	}
+	if len(blocked) == len(failures) {
+		// Every scraper was refused the page, e.g. a redirect to a private address
+		return nil, blocked[0]
+	}
+	return nil, fmt.Errorf("no scraper could read the page (%s)", strings.Join(failures, "; "))
+}
+
+// MatchesHost reports whether u is on domain or one of its subdomains.
+// "www.allrecipes.com" matches "allrecipes.com"; "notallrecipes.com" and
+// "allrecipes.com.evil" do not.
+func MatchesHost(u *url.URL, domain string) bool {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	domain = strings.ToLower(domain)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// matchesAnyHost is CanHandle for scrapers written for a fixed set of domains
+func matchesAnyHost(u *url.URL, domains []string) bool {
+	for _, d := range domains {
+		if MatchesHost(u, d) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	index "github.com/CaptSniper/RecipeServer/Index"
 	rfp "github.com/CaptSniper/RecipeServer/RFP"
 	ars "github.com/CaptSniper/RecipeServer/webScraper"
 	"github.com/gorilla/mux"
@@ -22,17 +29,32 @@ type RecipeSummary struct {
 	Name string `json:"name"` // recipe.Name from the file
 }
 
+// ScrapeRequest is the body of POST /scrape. With HTML set the page isn't
+// fetched; URL (or BaseURL) then only says where it came from.
 type ScrapeRequest struct {
-	URL  string `json:"url"`
-	Save bool   `json:"save"`
+	URL     string `json:"url"`
+	HTML    string `json:"html,omitempty"`
+	BaseURL string `json:"base_url,omitempty"`
+	Save    bool   `json:"save"`
 }
 
+// maxScrapeHTMLSize caps HTML posted to /scrape
+const maxScrapeHTMLSize = 10 << 20
+
+// recipeIndex is the SQLite index, or nil when it is disabled in the config
+var recipeIndex *index.Index
+
+// recipeMu serialises the If-Match check and the write that follows it,
+// so two concurrent updates cannot both pass the check against the same ETag
+var recipeMu sync.Mutex
+
 func StartApiServer() {
 	cfg, err := rfp.LoadConfig()
 	if err != nil {
 		fmt.Println("Failed to load config. Try running option 3 to create a default config:", err)
 		return
 	}
+	ars.Configure(cfg)
 	r := mux.NewRouter().StrictSlash(true)
 
 	r.HandleFunc("/recipes", listRecipesHandler).Methods("GET")
@@ -40,42 +62,234 @@ func StartApiServer() {
 	r.HandleFunc("/recipes", createRecipeHandler).Methods("POST")
 	r.HandleFunc("/recipes/{id}", updateRecipeHandler).Methods("PUT")
 	r.HandleFunc("/recipes/{id}", deleteRecipeHandler).Methods("DELETE")
+	r.HandleFunc("/search", searchHandler).Methods("GET")
+	r.HandleFunc("/suggest", suggestHandler).Methods("GET")
+	r.HandleFunc("/what-can-i-make", pantryHandler).Methods("POST")
 	r.HandleFunc("/scrape", scrapeRecipeHandler).Methods("POST")
+	r.HandleFunc("/scrape", scrapeSitesHandler).Methods("GET")
+	r.HandleFunc("/scrape/jobs", createScrapeJobHandler).Methods("POST")
+	r.HandleFunc("/scrape/jobs", listScrapeJobsHandler).Methods("GET")
+	r.HandleFunc("/scrape/jobs/{id}", getScrapeJobHandler).Methods("GET")
+	r.HandleFunc("/scrape/jobs/{id}", cancelScrapeJobHandler).Methods("DELETE")
+	r.HandleFunc("/trash", listTrashHandler).Methods("GET")
+	r.HandleFunc("/trash", purgeTrashHandler).Methods("DELETE")
+	r.HandleFunc("/trash/{id}/restore", restoreTrashHandler).Methods("POST")
+	r.HandleFunc("/images/{name}", imageHandler).Methods("GET")
+	r.HandleFunc("/recipes/{id}/image", uploadRecipeImageHandler).Methods("POST")
+	r.HandleFunc("/recipes/{id}/image", deleteRecipeImageHandler).Methods("DELETE")
+	r.HandleFunc("/recipes/{id}/move", moveRecipeHandler).Methods("POST")
+	r.HandleFunc("/recipes/{id}/history", recipeHistoryHandler).Methods("GET")
+	r.HandleFunc("/export", exportHandler).Methods("GET")
+	r.HandleFunc("/import", importHandler).Methods("POST")
+	r.HandleFunc("/admin/backup", backupHandler).Methods("POST")
+	r.HandleFunc("/admin/backups", listBackupsHandler).Methods("GET")
+	r.HandleFunc("/admin/reindex", reindexHandler).Methods("POST")
+	r.HandleFunc("/collections", listCollectionsHandler).Methods("GET")
+	r.HandleFunc("/collections", createCollectionHandler).Methods("POST")
+	r.HandleFunc("/collections/{id}", getCollectionHandler).Methods("GET")
+	r.HandleFunc("/collections/{id}", updateCollectionHandler).Methods("PUT")
+	r.HandleFunc("/collections/{id}", deleteCollectionHandler).Methods("DELETE")
+	r.HandleFunc("/collections/{id}/recipes/{recipeId}", addToCollectionHandler).Methods("PUT")
+	r.HandleFunc("/collections/{id}/recipes/{recipeId}", removeFromCollectionHandler).Methods("DELETE")
+
+	if cfg.GitStorage {
+		if err := rfp.InitGitRepo(cfg); err != nil {
+			fmt.Println("Failed to initialise git storage:", err)
+			return
+		}
+	}
+
+	if cfg.IndexEnabled {
+		recipeIndex, err = index.Open(cfg)
+		if err != nil {
+			fmt.Println("Failed to open index, falling back to reading files:", err)
+		} else if changed, err := recipeIndex.Sync(); err != nil {
+			fmt.Println("Failed to sync index:", err)
+		} else if changed > 0 {
+			fmt.Printf("Indexed %d recipe(s)\n", changed)
+		}
+	}
+
+	scrapeJobs, err = startScrapeQueue(cfg)
+	if err != nil {
+		fmt.Println("Failed to start scrape queue:", err)
+		return
+	}
+
+	go autoEmptyTrash(cfg)
+	go runBackupScheduler(cfg)
 
 	fmt.Println("Server running at http://localhost:" + strconv.Itoa(cfg.DefaultPort))
 	http.ListenAndServe(":"+strconv.Itoa(cfg.DefaultPort), r)
 }
 
-// listRecipesHandler – lists all recipes by name and ID
+// Page sizes for GET /recipes
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// RecipeList is the envelope returned by GET /recipes. Total counts every
+// recipe matching the filters; NextCursor is null on the last page.
+type RecipeList struct {
+	Recipes    []map[string]any `json:"recipes"`
+	Total      int              `json:"total"`
+	NextCursor *string          `json:"next_cursor"`
+}
+
+// listFields maps each ?fields= name to how it is read from a list row
+var listFields = map[string]func(index.RecipeInfo) any{
+	"id":            func(r index.RecipeInfo) any { return r.ID },
+	"name":          func(r index.RecipeInfo) any { return r.Name },
+	"image_url":     func(r index.RecipeInfo) any { return rfp.ImageURL(r.ImagePath) },
+	"servings":      func(r index.RecipeInfo) any { return r.Servings },
+	"prep_time":     func(r index.RecipeInfo) any { return r.PrepTime },
+	"cook_time":     func(r index.RecipeInfo) any { return r.CookTime },
+	"total_time":    func(r index.RecipeInfo) any { return r.TotalTime },
+	"prep_minutes":  func(r index.RecipeInfo) any { return r.PrepMinutes },
+	"cook_minutes":  func(r index.RecipeInfo) any { return r.CookMinutes },
+	"total_minutes": func(r index.RecipeInfo) any { return r.TotalMinutes },
+	"created":       func(r index.RecipeInfo) any { return r.Created.UTC() },
+	"updated":       func(r index.RecipeInfo) any { return r.Updated.UTC() },
+}
+
+// listRecipesHandler – lists recipes, one page at a time. Query:
+// filters ?collection=, ?q= (full text), ?ingredient=, ?tag= and
+// ?max_total_minutes= (recipes without a readable total time are left out);
+// ?sort=name|created|updated|total_time (prefix - for descending);
+// ?limit= and ?cursor= (the next_cursor of the previous page);
+// ?fields=id,name,... to choose what each recipe includes (default id,name)
 func listRecipesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sortBy, err := index.ParseSort(query.Get("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultListLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxListLimit {
+			http.Error(w, fmt.Sprintf("Limit must be between 1 and %d", maxListLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	var maxTotal *int
+	if m := query.Get("max_total_minutes"); m != "" {
+		n, err := strconv.Atoi(m)
+		if err != nil || n < 0 {
+			http.Error(w, "Max total minutes must be a whole number", http.StatusBadRequest)
+			return
+		}
+		maxTotal = &n
+	}
+	fields := []string{"id", "name"}
+	if f := query.Get("fields"); f != "" {
+		fields = strings.Split(f, ",")
+		for i, field := range fields {
+			fields[i] = strings.TrimSpace(field)
+			if listFields[fields[i]] == nil {
+				http.Error(w, "Unknown field: "+fields[i], http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
 	cfg, err := rfp.LoadConfig()
 	if err != nil {
 		http.Error(w, "Failed to load config", http.StatusInternalServerError)
 		return
 	}
-	files, err := os.ReadDir(cfg.DefaultRecipePath)
+
+	var inCollection map[string]bool
+	if collection := query.Get("collection"); collection != "" {
+		inCollection, err = rfp.CollectionRecipeIDs(cfg, collection)
+		if err != nil {
+			collectionError(w, err)
+			return
+		}
+	}
+	filter := index.Filter{
+		Query:      query.Get("q"),
+		Ingredient: query.Get("ingredient"),
+		Tag:        query.Get("tag"),
+
+		MaxTotalMinutes: maxTotal,
+	}
+
+	recipes, err := listRecipes(cfg, filter)
 	if err != nil {
 		http.Error(w, "Failed to read recipe directory", http.StatusInternalServerError)
 		return
 	}
+	if inCollection != nil {
+		filtered := []index.RecipeInfo{}
+		for _, recipe := range recipes {
+			if inCollection[recipe.ID] {
+				filtered = append(filtered, recipe)
+			}
+		}
+		recipes = filtered
+	}
+
+	page, next, err := index.Paginate(recipes, sortBy, query.Get("cursor"), limit)
+	if err != nil {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
 
-	var recipes []map[string]string
+	list := RecipeList{Recipes: []map[string]any{}, Total: len(recipes)}
+	for _, recipe := range page {
+		item := make(map[string]any, len(fields))
+		for _, field := range fields {
+			item[field] = listFields[field](recipe)
+		}
+		list.Recipes = append(list.Recipes, item)
+	}
+	if next != "" {
+		list.NextCursor = &next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// listRecipes answers a filtered list from the SQLite index when it is enabled,
+// and otherwise by decoding every recipe file
+func listRecipes(cfg *rfp.Config, filter index.Filter) ([]index.RecipeInfo, error) {
+	if recipeIndex != nil {
+		if _, err := recipeIndex.Sync(); err != nil {
+			log.Println("Failed to sync index, reading files instead:", err)
+		} else {
+			return recipeIndex.List(filter)
+		}
+	}
+
+	files, err := os.ReadDir(cfg.DefaultRecipePath)
+	if err != nil {
+		return nil, err
+	}
+
+	recipes := []index.RecipeInfo{}
 	for _, file := range files {
 		if filepath.Ext(file.Name()) == ".rfp" {
 			recipe, err := rfp.ReadRecipeFile(cfg.DefaultRecipePath, file.Name())
 			if err != nil {
 				continue // skip corrupted files
 			}
+			if !filter.Matches(recipe) {
+				continue
+			}
+			info, err := file.Info()
+			if err != nil {
+				continue
+			}
 			id := strings.TrimSuffix(file.Name(), ".rfp")
-			recipes = append(recipes, map[string]string{
-				"id":   id,
-				"name": recipe.Name,
-			})
+			recipes = append(recipes, index.NewRecipeInfo(id, recipe, info))
 		}
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(recipes)
+	return recipes, nil
 }
 
 // getRecipeHandler – gets a specific recipe by ID
@@ -93,6 +307,19 @@ func getRecipeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Tag before reading: if a write lands in between, the client holds a stale
+	// tag and its next update is rejected rather than silently accepted
+	etag, err := rfp.RecipeETag(cfg.DefaultRecipePath, id+".rfp")
+	if err != nil {
+		http.Error(w, "Failed to read recipe: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && rfp.ETagMatches(strings.ReplaceAll(inm, "W/", ""), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	recipe, err := rfp.ReadRecipeFile(cfg.DefaultRecipePath, id+".rfp")
 	if err != nil {
 		http.Error(w, "Failed to read recipe: "+err.Error(), http.StatusNotFound)
@@ -122,18 +349,23 @@ func createRecipeHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Recipe name is required", http.StatusBadRequest)
 		return
 	}
+	if !rfp.IsValidImagePath(recipe.ImagePath) {
+		http.Error(w, "Invalid image path", http.StatusBadRequest)
+		return
+	}
 
 	cfg, err := rfp.LoadConfig()
 	if err != nil {
 		http.Error(w, "Failed to load config", http.StatusInternalServerError)
 		return
 	}
-	id := strings.ReplaceAll(strings.ToLower(recipe.Name), " ", "_")
+	id := rfp.RecipeID(recipe.Name)
 
 	if err := rfp.WriteRecipe(cfg.DefaultRecipePath, id+".rfp", recipe); err != nil {
 		http.Error(w, "Failed to save recipe: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	recordChange(cfg, fmt.Sprintf("Create recipe %q", recipe.Name), id)
 
 	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "application/json")
@@ -143,11 +375,26 @@ func createRecipeHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// updateRecipeHandler – updates an existing recipe
-func updateRecipeHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
+// writableRecipeID – returns the {id} of a recipe about to be changed. Recipes are
+// only ever stored under rfp.RecipeID, so any other id answers 404 rather than
+// writing a second file next to the real one.
+func writableRecipeID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := mux.Vars(r)["id"]
 	if id == "" {
 		http.Error(w, "Missing recipe ID", http.StatusBadRequest)
+		return "", false
+	}
+	if id != rfp.RecipeID(id) {
+		http.Error(w, "Recipe not found", http.StatusNotFound)
+		return "", false
+	}
+	return id, true
+}
+
+// updateRecipeHandler – updates an existing recipe
+func updateRecipeHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := writableRecipeID(w, r)
+	if !ok {
 		return
 	}
 
@@ -158,23 +405,37 @@ func updateRecipeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	recipePath := filepath.Join(cfg.DefaultRecipePath, id+".rfp")
 
-	if _, err := os.Stat(recipePath); os.IsNotExist(err) {
-		http.Error(w, "Recipe not found", http.StatusNotFound)
-		return
-	}
-
 	var updated rfp.Recipe
 	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
 		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
+	if !rfp.IsValidImagePath(updated.ImagePath) {
+		http.Error(w, "Invalid image path", http.StatusBadRequest)
+		return
+	}
+
+	recipeMu.Lock()
+	defer recipeMu.Unlock()
+
+	if _, err := os.Stat(recipePath); os.IsNotExist(err) {
+		http.Error(w, "Recipe not found", http.StatusNotFound)
+		return
+	}
+	if !checkIfMatch(w, r, cfg, id) {
+		return
+	}
 
 	if err := rfp.WriteRecipe(cfg.DefaultRecipePath, id+".rfp", updated); err != nil {
 		http.Error(w, "Failed to update recipe: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	recordChange(cfg, fmt.Sprintf("Update recipe %q", updated.Name), id)
 
+	if etag, err := rfp.RecipeETag(cfg.DefaultRecipePath, id+".rfp"); err == nil {
+		w.Header().Set("ETag", etag)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Recipe updated successfully",
@@ -184,10 +445,8 @@ func updateRecipeHandler(w http.ResponseWriter, r *http.Request) {
 
 // deleteRecipeHandler – deletes a recipe
 func deleteRecipeHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-	if id == "" {
-		http.Error(w, "Missing recipe ID", http.StatusBadRequest)
+	id, ok := writableRecipeID(w, r)
+	if !ok {
 		return
 	}
 
@@ -198,40 +457,653 @@ func deleteRecipeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	recipePath := filepath.Join(cfg.DefaultRecipePath, id+".rfp")
 
-	if err := os.Remove(recipePath); err != nil {
+	recipeMu.Lock()
+	defer recipeMu.Unlock()
+
+	if _, err := os.Stat(recipePath); os.IsNotExist(err) {
+		http.Error(w, "Recipe not found", http.StatusNotFound)
+		return
+	}
+	if !checkIfMatch(w, r, cfg, id) {
+		return
+	}
+
+	entry, err := rfp.MoveToTrash(cfg, id)
+	if err != nil {
 		http.Error(w, "Failed to delete recipe: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	recordChange(cfg, fmt.Sprintf("Delete recipe %q (moved to trash)", entry.Name), id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":  "Recipe moved to trash",
+		"id":       id,
+		"trash_id": entry.TrashID,
+	})
+}
+
+// listTrashHandler – lists deleted recipes that can still be restored
+func listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	entries, err := rfp.ListTrash(cfg)
+	if err != nil {
+		http.Error(w, "Failed to read trash: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// restoreTrashHandler – moves a trashed recipe back into the recipe directory
+func restoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	trashID := vars["id"]
+	if trashID == "" {
+		http.Error(w, "Missing trash ID", http.StatusBadRequest)
+		return
+	}
+
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	recipeMu.Lock()
+	defer recipeMu.Unlock()
+
+	id, err := rfp.RestoreFromTrash(cfg, trashID)
+	if errors.Is(err, rfp.ErrRecipeExists) {
+		http.Error(w, "Failed to restore recipe: "+err.Error(), http.StatusConflict)
+		return
+	}
+	if os.IsNotExist(err) {
+		http.Error(w, "Trash entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to restore recipe: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordChange(cfg, fmt.Sprintf("Restore recipe %s from trash", id), id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Recipe restored successfully",
+		"id":      id,
+	})
+}
+
+// purgeTrashHandler – permanently empties the trash
+func purgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	purged, err := rfp.PurgeTrash(cfg, 0)
+	if purged > 0 {
+		recordCollectionChange(cfg, fmt.Sprintf("Empty trash (%d recipe(s))", purged))
+	}
+	if err != nil {
+		http.Error(w, "Failed to empty trash: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"message": "Trash emptied",
+		"purged":  purged,
+	})
+}
+
+// autoEmptyTrash purges entries past the configured retention period, once at
+// startup and then hourly. A retention of 0 days disables it.
+func autoEmptyTrash(cfg *rfp.Config) {
+	if cfg.TrashRetentionDays <= 0 {
+		return
+	}
+	retention := time.Duration(cfg.TrashRetentionDays) * 24 * time.Hour
+
+	for {
+		purged, err := rfp.PurgeTrash(cfg, retention)
+		if purged > 0 {
+			recordCollectionChange(cfg, fmt.Sprintf("Auto-empty trash (%d recipe(s))", purged))
+		}
+		if err != nil {
+			log.Println("Failed to auto-empty trash:", err)
+		} else if purged > 0 {
+			log.Printf("Auto-emptied %d trashed recipe(s)", purged)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// searchHandler – ranked full text search. Query: ?q=<words or "a phrase">&limit=20
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	if recipeIndex == nil {
+		http.Error(w, "Search requires the index to be enabled", http.StatusServiceUnavailable)
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "Missing search query", http.StatusBadRequest)
+		return
+	}
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 100 {
+			http.Error(w, "Limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	// Catch changes made outside the API, e.g. from the CLI
+	if _, err := recipeIndex.Sync(); err != nil {
+		log.Println("Failed to sync index:", err)
+	}
+	results, err := recipeIndex.Search(q, limit)
+	if err != nil {
+		http.Error(w, "Search failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Nothing found: retry with misspelt words corrected and say so
+	didYouMean := ""
+	if len(results) == 0 {
+		if didYouMean, err = recipeIndex.DidYouMean(q); err != nil {
+			log.Println("Failed to correct query:", err)
+		} else if didYouMean != "" {
+			if results, err = recipeIndex.Search(didYouMean, limit); err != nil {
+				http.Error(w, "Search failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	response := map[string]any{
+		"query":   q,
+		"results": results,
+	}
+	if didYouMean != "" {
+		response["did_you_mean"] = didYouMean
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// suggestHandler – typo-tolerant autocomplete on recipe names. Query: ?prefix=&limit=10
+func suggestHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.TrimSpace(r.URL.Query().Get("prefix"))
+	limit := 10
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 50 {
+			http.Error(w, "Limit must be between 1 and 50", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	var suggestions []index.Summary
+	if recipeIndex != nil {
+		var err error
+		suggestions, err = recipeIndex.Suggest(prefix, limit)
+		if err != nil {
+			http.Error(w, "Failed to suggest: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		cfg, err := rfp.LoadConfig()
+		if err != nil {
+			http.Error(w, "Failed to load config", http.StatusInternalServerError)
+			return
+		}
+		recipes, err := listRecipes(cfg, index.Filter{})
+		if err != nil {
+			http.Error(w, "Failed to read recipe directory", http.StatusInternalServerError)
+			return
+		}
+		suggestions = index.SuggestNames(index.Summaries(recipes), prefix, limit)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
+
+// PantryRequest is the body of POST /what-can-i-make
+type PantryRequest struct {
+	Ingredients []string `json:"ingredients"`
+	MaxMissing  *int     `json:"max_missing,omitempty"` // drop recipes missing more than this
+	Limit       int      `json:"limit,omitempty"`
+}
+
+// pantryHandler – ranks recipes by how many of their ingredients are on hand
+func pantryHandler(w http.ResponseWriter, r *http.Request) {
+	var req PantryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Ingredients) == 0 {
+		http.Error(w, "No ingredients given", http.StatusBadRequest)
+		return
+	}
+
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+	recipes, err := allIngredients(cfg)
+	if err != nil {
+		http.Error(w, "Failed to read recipes", http.StatusInternalServerError)
+		return
+	}
+
+	ranked := index.RankByCoverage(recipes, req.Ingredients)
+	if req.MaxMissing != nil {
+		filtered := []index.Coverage{}
+		for _, c := range ranked {
+			if len(c.Missing) <= *req.MaxMissing {
+				filtered = append(filtered, c)
+			}
+		}
+		ranked = filtered
+	}
+	if req.Limit > 0 && len(ranked) > req.Limit {
+		ranked = ranked[:req.Limit]
+	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ranked)
+}
+
+// allIngredients returns every recipe's ingredient lines, from the index when
+// it is enabled and otherwise by decoding every recipe file
+func allIngredients(cfg *rfp.Config) ([]index.RecipeIngredients, error) {
+	if recipeIndex != nil {
+		if _, err := recipeIndex.Sync(); err != nil {
+			log.Println("Failed to sync index, reading files instead:", err)
+		} else {
+			return recipeIndex.AllIngredients()
+		}
+	}
+
+	files, err := os.ReadDir(cfg.DefaultRecipePath)
+	if err != nil {
+		return nil, err
+	}
+	recipes := []index.RecipeIngredients{}
+	for _, file := range files {
+		if filepath.Ext(file.Name()) != ".rfp" {
+			continue
+		}
+		recipe, err := rfp.ReadRecipeFile(cfg.DefaultRecipePath, file.Name())
+		if err != nil {
+			continue // skip corrupted files
+		}
+		recipes = append(recipes, index.RecipeIngredientsOf(strings.TrimSuffix(file.Name(), ".rfp"), recipe))
+	}
+	return recipes, nil
+}
+
+// reindexHandler – rebuilds the SQLite index from the recipe files
+func reindexHandler(w http.ResponseWriter, r *http.Request) {
+	if recipeIndex == nil {
+		http.Error(w, "The index is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	count, err := recipeIndex.Rebuild()
+	if err != nil {
+		http.Error(w, "Failed to rebuild index: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"message": "Index rebuilt",
+		"indexed": count,
+	})
+}
+
+// recipeHistoryHandler – lists the git commits that touched a recipe
+func recipeHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	commits, err := rfp.RecipeHistory(cfg, id)
+	if errors.Is(err, rfp.ErrGitDisabled) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(commits) == 0 {
+		http.Error(w, "Recipe not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(commits)
+}
+
+// recordChange runs after every write: it refreshes the index entries for ids
+// (everything when none are given) and commits the change in git storage mode. The file is already
+// written by the time this runs, so a failed commit is logged rather than reported.
+func recordChange(cfg *rfp.Config, message string, ids ...string) {
+	if recipeIndex != nil {
+		var err error
+		if len(ids) > 0 {
+			err = recipeIndex.Refresh(ids...)
+		} else {
+			_, err = recipeIndex.Sync()
+		}
+		if err != nil {
+			log.Println("Failed to update index:", err)
+		}
+	}
+	if err := rfp.RecordChange(cfg, message, ids...); err != nil {
+		log.Println("Failed to commit change:", err)
+	}
+}
+
+// checkIfMatch enforces optimistic concurrency on writes to an existing recipe.
+// A stale If-Match gets 412; a missing one gets 428 when the config requires it.
+// It writes the error response itself and returns false if the write must not proceed.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, cfg *rfp.Config, id string) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		if cfg.RequireIfMatch {
+			http.Error(w, "If-Match header is required", http.StatusPreconditionRequired)
+			return false
+		}
+		return true
+	}
+
+	etag, err := rfp.RecipeETag(cfg.DefaultRecipePath, id+".rfp")
+	if err != nil {
+		http.Error(w, "Failed to read recipe: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !rfp.ETagMatches(ifMatch, etag) {
+		w.Header().Set("ETag", etag)
+		http.Error(w, "Recipe was modified by someone else", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// uploadRecipeImageHandler – replaces a recipe's image with a multipart upload in the "image" field
+func uploadRecipeImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := writableRecipeID(w, r)
+	if !ok {
+		return
+	}
+
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+	maxBytes := int64(cfg.MaxImageUploadMB) << 20
+	if maxBytes <= 0 {
+		maxBytes = 10 << 20
+	}
+
+	// Allow some room for the multipart framing around the file itself
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20)
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Image is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Missing image file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > maxBytes {
+		http.Error(w, "Image is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Trust the bytes, not the client's Content-Type
+	if contentType := http.DetectContentType(data); !rfp.IsSupportedImageType(contentType) {
+		http.Error(w, "Unsupported image type: "+contentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	data, err = rfp.StripImageMetadata(data)
+	if err != nil {
+		http.Error(w, "Invalid image: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recipeMu.Lock()
+	defer recipeMu.Unlock()
+
+	recipe, err := rfp.ReadRecipeFile(cfg.DefaultRecipePath, id+".rfp")
+	if err != nil {
+		http.Error(w, "Recipe not found", http.StatusNotFound)
+		return
+	}
+	if !checkIfMatch(w, r, cfg, id) {
+		return
+	}
+
+	ref, err := rfp.StoreImage(cfg.DefaultImagePath, bytes.NewReader(data))
+	if err != nil {
+		http.Error(w, "Failed to save image: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recipe.ImagePath = ref
+	if err := rfp.WriteRecipe(cfg.DefaultRecipePath, id+".rfp", *recipe); err != nil {
+		http.Error(w, "Failed to update recipe: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordChange(cfg, fmt.Sprintf("Upload image for recipe %q", recipe.Name), id)
+
+	if etag, err := rfp.RecipeETag(cfg.DefaultRecipePath, id+".rfp"); err == nil {
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Image uploaded successfully",
+		"id":      id,
+		"image":   ref,
+	})
+}
+
+// deleteRecipeImageHandler – removes a recipe's image; the file itself is left for the image GC
+func deleteRecipeImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := writableRecipeID(w, r)
+	if !ok {
+		return
+	}
+
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	recipeMu.Lock()
+	defer recipeMu.Unlock()
+
+	recipe, err := rfp.ReadRecipeFile(cfg.DefaultRecipePath, id+".rfp")
+	if err != nil {
+		http.Error(w, "Recipe not found", http.StatusNotFound)
+		return
+	}
+	if !checkIfMatch(w, r, cfg, id) {
+		return
+	}
+
+	recipe.ImagePath = ""
+	if err := rfp.WriteRecipe(cfg.DefaultRecipePath, id+".rfp", *recipe); err != nil {
+		http.Error(w, "Failed to update recipe: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordChange(cfg, fmt.Sprintf("Remove image from recipe %q", recipe.Name), id)
+
+	if etag, err := rfp.RecipeETag(cfg.DefaultRecipePath, id+".rfp"); err == nil {
+		w.Header().Set("ETag", etag)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Recipe deleted successfully",
+		"message": "Image removed successfully",
 		"id":      id,
 	})
 }
 
+// imageHandler – serves an image from the image directory. Stored images can be
+// resized with ?size=thumbnail|medium|large.
+func imageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	size := r.URL.Query().Get("size")
+	if _, ok := rfp.ImageSizes[size]; size != "" && !ok {
+		http.Error(w, "Unknown image size: "+size, http.StatusBadRequest)
+		return
+	}
+
+	f, err := rfp.OpenImage(cfg.DefaultImagePath, name, size)
+	if err != nil {
+		// Path escapes and missing files look the same to the client
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+
+	// Serve the sniffed type rather than trusting the file extension, and only images
+	head := make([]byte, 512)
+	n, _ := f.ReadAt(head, 0)
+	contentType := http.DetectContentType(head[:n])
+	if !strings.HasPrefix(contentType, "image/") {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if rfp.IsImageRef(name) {
+		// Refs are content hashes, so a given URL always serves the same bytes
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	}
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// readScrapeRequest reads POST /scrape as JSON, or as a multipart form with the
+// page in a "file" field alongside url, base_url and save fields
+func readScrapeRequest(w http.ResponseWriter, r *http.Request) (ScrapeRequest, error) {
+	var req ScrapeRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxScrapeHTMLSize+1<<20)
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, fmt.Errorf("invalid request body")
+		}
+		if len(req.HTML) > maxScrapeHTMLSize {
+			return req, fmt.Errorf("HTML is too large")
+		}
+		if req.HTML == "" && req.URL == "" {
+			return req, fmt.Errorf("missing url or html")
+		}
+		return req, nil
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return req, fmt.Errorf("missing HTML file")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxScrapeHTMLSize+1))
+	if err != nil {
+		return req, fmt.Errorf("invalid request body")
+	}
+	if len(data) > maxScrapeHTMLSize {
+		return req, fmt.Errorf("HTML is too large")
+	}
+	if len(data) == 0 {
+		return req, fmt.Errorf("HTML file is empty")
+	}
+	req.HTML = string(data)
+	req.URL = r.FormValue("url")
+	req.BaseURL = r.FormValue("base_url")
+	req.Save, _ = strconv.ParseBool(r.FormValue("save"))
+	return req, nil
+}
+
+// scrapeSitesHandler – lists the scrapers in the order they are tried
+func scrapeSitesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ars.DefaultRegistry.Sites())
+}
+
 func scrapeRecipeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var req ScrapeRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	req, err := readScrapeRequest(w, r)
+	if err != nil {
+		http.Error(w, "Invalid scrape request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Determine default image path from config
 	config, err := rfp.LoadConfig()
 	if err != nil {
 		http.Error(w, "Failed to load config", http.StatusInternalServerError)
 		return
 	}
-	imagePath := config.DefaultImagePath
 
-	// Scrape the recipe
-	recipe, err := ars.ScrapeRecipe(req.URL, imagePath)
+	result, err := runScrape(r.Context(), config, req)
+	if errors.Is(err, ars.ErrBlocked) {
+		http.Error(w, fmt.Sprintf("URL not allowed: %v", err), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to scrape recipe: %v", err), http.StatusBadRequest)
 		return
@@ -239,12 +1111,41 @@ func scrapeRecipeHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Optionally save the recipe immediately
 	if req.Save {
-		if err := rfp.WriteRecipe(config.DefaultRecipePath, recipe.Name, *recipe); err != nil {
+		if err := saveScraped(config, req, result); err != nil {
 			http.Error(w, fmt.Sprintf("Failed to save recipe: %v", err), http.StatusInternalServerError)
 			return
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(recipe)
+	json.NewEncoder(w).Encode(result)
+}
+
+// runScrape scrapes req.URL, or req.HTML when it was sent, saving the image
+// into the configured image directory
+func runScrape(ctx context.Context, config *rfp.Config, req ScrapeRequest) (*ars.ScrapeResult, error) {
+	if req.HTML != "" {
+		baseURL := req.BaseURL
+		if baseURL == "" {
+			baseURL = req.URL
+		}
+		return ars.ScrapeRecipeHTML(ctx, []byte(req.HTML), baseURL, config.DefaultImagePath)
+	}
+	return ars.ScrapeRecipe(ctx, req.URL, config.DefaultImagePath)
+}
+
+// saveScraped writes a scraped recipe and records the change
+func saveScraped(config *rfp.Config, req ScrapeRequest, result *ars.ScrapeResult) error {
+	recipe := result.Recipe
+	recipeMu.Lock()
+	defer recipeMu.Unlock()
+	if err := rfp.WriteRecipe(config.DefaultRecipePath, recipe.Name, *recipe); err != nil {
+		return err
+	}
+	source := req.URL
+	if source == "" {
+		source = "uploaded HTML"
+	}
+	recordChange(config, fmt.Sprintf("Scrape recipe %q from %s", recipe.Name, source), rfp.RecipeID(recipe.Name))
+	return nil
 }
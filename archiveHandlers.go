@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	rfp "github.com/CaptSniper/RecipeServer/RFP"
+)
+
+// maxImportSize caps the archive accepted by POST /import
+const maxImportSize = 512 << 20
+
+// exportHandler – streams a zip of every recipe, its image and the collections
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	filename := "recipes-" + time.Now().Format("20060102") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	// Headers are already sent once streaming starts, so errors can only be logged
+	if err := rfp.ExportLibrary(cfg, w); err != nil {
+		log.Println("Export failed:", err)
+	}
+}
+
+// importHandler – imports a zip made by /export, sent as the raw body or as a
+// multipart "file" field. Query: ?policy=skip|overwrite|rename&dry_run=true
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	policy, err := rfp.ParseConflictPolicy(r.URL.Query().Get("policy"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Missing archive file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	// zip needs random access, so spool the upload to disk first
+	tmp, err := os.CreateTemp("", "recipe-import-*.zip")
+	if err != nil {
+		http.Error(w, "Failed to store upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	recipeMu.Lock()
+	report, err := rfp.ImportLibrary(cfg, tmp, size, policy, dryRun)
+	recipeMu.Unlock()
+	if err != nil {
+		http.Error(w, "Failed to import: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !dryRun {
+		recordChange(cfg, fmt.Sprintf("Import %d recipe(s) from archive", len(report.Recipes)))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	rfp "github.com/CaptSniper/RecipeServer/RFP"
+)
+
+// backupHandler – snapshots the recipe and image directories right away
+func backupHandler(w http.ResponseWriter, r *http.Request) {
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	// Hold off writes so the snapshot is consistent
+	recipeMu.Lock()
+	name, err := rfp.CreateBackup(cfg)
+	recipeMu.Unlock()
+	if err != nil {
+		http.Error(w, "Failed to create backup: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Backup created successfully",
+		"name":    name,
+	})
+}
+
+// listBackupsHandler – lists backup archives, newest first
+func listBackupsHandler(w http.ResponseWriter, r *http.Request) {
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	backups, err := rfp.ListBackups(cfg)
+	if err != nil {
+		http.Error(w, "Failed to read backups: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(backups)
+}
+
+// runBackupScheduler takes a backup every BackupIntervalHours, counted from the
+// newest existing backup so restarts don't reset the clock. An interval of 0 disables it.
+func runBackupScheduler(cfg *rfp.Config) {
+	if cfg.BackupIntervalHours <= 0 {
+		return
+	}
+	interval := time.Duration(cfg.BackupIntervalHours) * time.Hour
+
+	for {
+		next := time.Now()
+		if backups, err := rfp.ListBackups(cfg); err == nil && len(backups) > 0 {
+			next = backups[0].CreatedAt.Add(interval)
+		}
+		time.Sleep(time.Until(next))
+
+		recipeMu.Lock()
+		name, err := rfp.CreateBackup(cfg)
+		recipeMu.Unlock()
+		if err != nil {
+			log.Println("Scheduled backup failed:", err)
+			// Retry later rather than spinning on a persistent failure
+			time.Sleep(time.Hour)
+			continue
+		}
+		log.Println("Scheduled backup created:", name)
+	}
+}
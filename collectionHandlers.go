@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	rfp "github.com/CaptSniper/RecipeServer/RFP"
+	"github.com/gorilla/mux"
+)
+
+type CollectionRequest struct {
+	Name   string  `json:"name"`
+	Parent *string `json:"parent"` // on update, absent keeps the current parent and "" moves to the top level
+}
+
+type MoveRecipeRequest struct {
+	From string `json:"from"` // optional; empty just adds the recipe to To
+	To   string `json:"to"`
+}
+
+// collectionError maps collection errors onto HTTP status codes
+func collectionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rfp.ErrCollectionNotFound), errors.Is(err, rfp.ErrNotInCollection):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, rfp.ErrCollectionExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, rfp.ErrCollectionCycle):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Failed to update collections: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// recordCollectionChange commits the collections manifest after an API write.
+// A failed commit is logged; the change itself is already saved.
+func recordCollectionChange(cfg *rfp.Config, message string) {
+	if err := rfp.RecordChange(cfg, message, rfp.CollectionsFile); err != nil {
+		log.Println("Failed to commit change:", err)
+	}
+}
+
+// listCollectionsHandler – lists all collections with their recipe IDs
+func listCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	collections, err := rfp.LoadCollections(cfg)
+	if err != nil {
+		http.Error(w, "Failed to read collections: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collections)
+}
+
+// getCollectionHandler – gets a collection with summaries of its recipes, including those of sub-collections
+func getCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	collections, err := rfp.LoadCollections(cfg)
+	if err != nil {
+		http.Error(w, "Failed to read collections: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var collection *rfp.Collection
+	for i := range collections {
+		if collections[i].ID == id {
+			collection = &collections[i]
+		}
+	}
+	if collection == nil {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+
+	ids, err := rfp.CollectionRecipeIDs(cfg, id)
+	if err != nil {
+		collectionError(w, err)
+		return
+	}
+	recipes := []RecipeSummary{}
+	for recipeID := range ids {
+		recipe, err := rfp.ReadRecipeFile(cfg.DefaultRecipePath, recipeID+".rfp")
+		if err != nil {
+			continue // trashed or corrupted
+		}
+		recipes = append(recipes, RecipeSummary{ID: recipeID, Name: recipe.Name})
+	}
+
+	children := []string{}
+	for _, c := range collections {
+		if c.Parent == id {
+			children = append(children, c.ID)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":          collection.ID,
+		"name":        collection.Name,
+		"parent":      collection.Parent,
+		"collections": children,
+		"recipes":     recipes,
+	})
+}
+
+// createCollectionHandler – creates an empty collection
+func createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "Collection name is required", http.StatusBadRequest)
+		return
+	}
+
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	parent := ""
+	if req.Parent != nil {
+		parent = *req.Parent
+	}
+	collection, err := rfp.CreateCollection(cfg, req.Name, parent)
+	if err != nil {
+		collectionError(w, err)
+		return
+	}
+	recordCollectionChange(cfg, fmt.Sprintf("Create collection %q", collection.Name))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(collection)
+}
+
+// updateCollectionHandler – renames a collection or moves it under another parent
+func updateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	if err := rfp.UpdateCollection(cfg, id, req.Name, req.Parent); err != nil {
+		collectionError(w, err)
+		return
+	}
+	recordCollectionChange(cfg, fmt.Sprintf("Update collection %q", id))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Collection updated successfully",
+		"id":      id,
+	})
+}
+
+// deleteCollectionHandler – deletes a collection but keeps its recipes
+func deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	if err := rfp.DeleteCollection(cfg, id); err != nil {
+		collectionError(w, err)
+		return
+	}
+	recordCollectionChange(cfg, fmt.Sprintf("Delete collection %q", id))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Collection deleted successfully",
+		"id":      id,
+	})
+}
+
+// addToCollectionHandler – adds a recipe to a collection
+func addToCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	recipeID := vars["recipeId"]
+
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+	if _, err := os.Stat(filepath.Join(cfg.DefaultRecipePath, recipeID+".rfp")); os.IsNotExist(err) {
+		http.Error(w, "Recipe not found", http.StatusNotFound)
+		return
+	}
+
+	if err := rfp.AddToCollection(cfg, id, recipeID); err != nil {
+		collectionError(w, err)
+		return
+	}
+	recordCollectionChange(cfg, fmt.Sprintf("Add %q to collection %q", recipeID, id))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Recipe added to collection",
+		"id":      id,
+	})
+}
+
+// removeFromCollectionHandler – takes a recipe out of a collection
+func removeFromCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	recipeID := vars["recipeId"]
+
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	if err := rfp.RemoveFromCollection(cfg, id, recipeID); err != nil {
+		collectionError(w, err)
+		return
+	}
+	recordCollectionChange(cfg, fmt.Sprintf("Remove %q from collection %q", recipeID, id))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Recipe removed from collection",
+		"id":      id,
+	})
+}
+
+// moveRecipeHandler – moves a recipe from one collection to another
+func moveRecipeHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	recipeID := vars["id"]
+
+	var req MoveRecipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if req.To == "" {
+		http.Error(w, "Destination collection is required", http.StatusBadRequest)
+		return
+	}
+
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+	if _, err := os.Stat(filepath.Join(cfg.DefaultRecipePath, recipeID+".rfp")); os.IsNotExist(err) {
+		http.Error(w, "Recipe not found", http.StatusNotFound)
+		return
+	}
+
+	if err := rfp.MoveRecipe(cfg, recipeID, req.From, req.To); err != nil {
+		collectionError(w, err)
+		return
+	}
+	recordCollectionChange(cfg, fmt.Sprintf("Move %q to collection %q", recipeID, req.To))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Recipe moved successfully",
+		"id":      recipeID,
+	})
+}
@@ -2,12 +2,14 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	index "github.com/CaptSniper/RecipeServer/Index"
 	rfp "github.com/CaptSniper/RecipeServer/RFP"
 	ars "github.com/CaptSniper/RecipeServer/webScraper"
 )
@@ -15,6 +17,20 @@ import (
 func main() {
 	reader := bufio.NewReader(os.Stdin)
 
+	// recipe_tool scrape <url or html file> [page url]
+	if len(os.Args) > 1 {
+		if os.Args[1] != "scrape" || len(os.Args) < 3 || len(os.Args) > 4 {
+			fmt.Println("Usage: recipe_tool [scrape <url or html file> [page url]]")
+			os.Exit(2)
+		}
+		baseURL := ""
+		if len(os.Args) == 4 {
+			baseURL = os.Args[3]
+		}
+		scrapeAndSave(reader, os.Args[2], baseURL)
+		return
+	}
+
 	for {
 		fmt.Println("Recipe File Program")
 		fmt.Println("-------------------")
@@ -22,8 +38,14 @@ func main() {
 		fmt.Println("1) Create a recipe file")
 		fmt.Println("2) Read a recipe file")
 		fmt.Println("3) Create/Edit config")
-		fmt.Println("4) Scrape AllRecipes")
+		fmt.Println("4) Scrape a recipe from a URL or saved page")
 		fmt.Println("5) Start API Server")
+		fmt.Println("7) Empty trash")
+		fmt.Println("8) Clean up unused images")
+		fmt.Println("9) Export library to zip")
+		fmt.Println("10) Import library from zip")
+		fmt.Println("11) Restore from backup")
+		fmt.Println("12) Rebuild search index")
 		fmt.Print("> ")
 
 		var choice int
@@ -43,6 +65,18 @@ func main() {
 			go StartApiServer()
 		case 6:
 			go StartWebServer()
+		case 7:
+			emptyTrash()
+		case 8:
+			collectImages()
+		case 9:
+			exportLibrary(reader)
+		case 10:
+			importLibrary(reader)
+		case 11:
+			restoreBackup(reader)
+		case 12:
+			reindex()
 		default:
 			fmt.Println("Unknown option")
 		}
@@ -60,8 +94,8 @@ func createRecipe(reader *bufio.Reader) {
 
 	// Image path
 	fmt.Print("Image path: ")
-	r.ImagePath, _ = reader.ReadString('\n')
-	r.ImagePath = strings.TrimSpace(r.ImagePath)
+	imagePath, _ := reader.ReadString('\n')
+	imagePath = strings.TrimSpace(imagePath)
 
 	// Core properties
 	fmt.Println("\nEnter recipe properties (e.g. Prep Time: 15 mins, Servings: 4).")
@@ -120,11 +154,41 @@ func createRecipe(reader *bufio.Reader) {
 		fmt.Println("Failed to load config:", err)
 		return
 	}
+
+	// Copy the image into the image store so the recipe doesn't depend on its original location
+	if imagePath != "" {
+		ref, err := rfp.StoreImageFile(cfg.DefaultImagePath, imagePath)
+		if err != nil {
+			fmt.Println("Failed to import image:", err)
+			return
+		}
+		r.ImagePath = ref
+	}
+
 	if err := rfp.WriteRecipe(cfg.DefaultRecipePath, path, r); err != nil {
 		fmt.Println("Error writing recipe:", err)
 		return
 	}
-	fmt.Println("Recipe saved to", path)
+	if err := rfp.RecordChange(cfg, fmt.Sprintf("Create recipe %q from CLI", r.Name), rfp.RecipeID(path)); err != nil {
+		fmt.Println("Failed to commit recipe:", err)
+	}
+	fmt.Println("Recipe saved as", rfp.RecipeID(path)+".rfp")
+}
+
+// timeText shows a recipe time as "1 hr 15 mins", whatever form it was
+// stored in. Text that isn't a time is shown as is; a missing time shows
+// fallback, or "-" when that is zero too.
+func timeText(text string, fallback time.Duration) string {
+	d, ok := rfp.ParseDuration(text)
+	switch {
+	case ok && d > 0:
+		return rfp.FormatDuration(d)
+	case strings.TrimSpace(text) != "":
+		return text
+	case fallback > 0:
+		return rfp.FormatDuration(fallback)
+	}
+	return "-"
 }
 
 func readRecipe(reader *bufio.Reader) {
@@ -132,22 +196,22 @@ func readRecipe(reader *bufio.Reader) {
 	var filename string
 	filename, _ = reader.ReadString('\n')
 	filename = strings.TrimSpace(filename)
-	path := filepath.Clean(filename)
 	cfg, err := rfp.LoadConfig()
 	if err != nil {
 		fmt.Println("Failed to load config:", err)
 		return
 	}
-	r, err := rfp.ReadRecipeFile(path, cfg.DefaultRecipePath)
+	r, err := rfp.ReadRecipeFile(cfg.DefaultRecipePath, rfp.RecipeID(filename)+".rfp")
 	if err != nil {
 		fmt.Println("Error reading recipe:", err)
 		return
 	}
 
 	fmt.Printf("Image Path: %s\n", r.ImagePath)
-	fmt.Printf("Prep: %s min, Cook: %s min, Additional: %s min, Total: %s min\n",
-		r.CoreProps["prep time"], r.CoreProps["cook time"], r.CoreProps["additional time"], r.CoreProps["total time"])
-	fmt.Printf("Servings: %s\n", r.CoreProps["servings"])
+	fmt.Printf("Prep: %s, Cook: %s, Additional: %s, Total: %s\n",
+		timeText(r.Prop("prep time"), 0), timeText(r.Prop("cook time"), 0),
+		timeText(r.Prop("additional time"), 0), timeText(r.Prop("total time"), r.Times().Total))
+	fmt.Printf("Servings: %s\n", r.Prop("servings"))
 
 	fmt.Println("\nIngredients:")
 	for i, ing := range r.Ingredients {
@@ -175,29 +239,265 @@ func editConfig() {
 	rfp.EditConfig(cfg)
 }
 
-func ScrapeAS() {
-	config, err := rfp.LoadConfig()
+func emptyTrash() {
+	cfg, err := rfp.LoadConfig()
 	if err != nil {
 		fmt.Println("Failed to load config:", err)
 		return
 	}
 
-	reader := bufio.NewReader(os.Stdin)
-	var url string
-	fmt.Scan(&url)
+	purged, err := rfp.PurgeTrash(cfg, 0)
+	if purged > 0 {
+		if err := rfp.RecordChange(cfg, fmt.Sprintf("Empty trash (%d recipe(s)) from CLI", purged), rfp.CollectionsFile); err != nil {
+			fmt.Println("Failed to commit change:", err)
+		}
+	}
+	if err != nil {
+		fmt.Println("Failed to empty trash:", err)
+		return
+	}
+	fmt.Printf("Permanently deleted %d recipe(s) from the trash\n", purged)
+}
+
+func collectImages() {
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		fmt.Println("Failed to load config:", err)
+		return
+	}
+
+	removed, err := rfp.CollectImageGarbage(cfg)
+	if err != nil {
+		fmt.Println("Failed to clean up images:", err)
+		return
+	}
+	for _, ref := range removed {
+		fmt.Println("Removed", ref)
+	}
+	fmt.Printf("Removed %d unused image(s)\n", len(removed))
+}
+
+func exportLibrary(reader *bufio.Reader) {
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		fmt.Println("Failed to load config:", err)
+		return
+	}
+
+	fmt.Print("Zip file to write (e.g., recipes.zip): ")
+	path, _ := reader.ReadString('\n')
+	path = filepath.Clean(strings.TrimSpace(path))
+
+	out, err := os.Create(path)
+	if err != nil {
+		fmt.Println("Failed to create file:", err)
+		return
+	}
+	defer out.Close()
+
+	if err := rfp.ExportLibrary(cfg, out); err != nil {
+		fmt.Println("Export failed:", err)
+		return
+	}
+	fmt.Println("Library exported to", path)
+}
+
+func importLibrary(reader *bufio.Reader) {
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		fmt.Println("Failed to load config:", err)
+		return
+	}
+
+	fmt.Print("Zip file to import: ")
+	path, _ := reader.ReadString('\n')
+	path = filepath.Clean(strings.TrimSpace(path))
+
+	fmt.Print("On conflict: skip, overwrite or rename [skip]: ")
+	answer, _ := reader.ReadString('\n')
+	policy, err := rfp.ParseConflictPolicy(strings.TrimSpace(answer))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Print("Dry run? (y/n) [y]: ")
+	answer, _ = reader.ReadString('\n')
+	dryRun := !strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "n")
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Println("Failed to open archive:", err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		fmt.Println("Failed to open archive:", err)
+		return
+	}
+
+	report, err := rfp.ImportLibrary(cfg, f, info.Size(), policy, dryRun)
+	if err != nil {
+		fmt.Println("Import failed:", err)
+		return
+	}
+	if !dryRun {
+		if err := rfp.RecordChange(cfg, fmt.Sprintf("Import %d recipe(s) from %s", len(report.Recipes), filepath.Base(path))); err != nil {
+			fmt.Println("Failed to commit import:", err)
+		}
+	}
+
+	if report.DryRun {
+		fmt.Println("\nDry run, nothing was written:")
+	}
+	for _, rec := range report.Recipes {
+		if rec.NewID != "" {
+			fmt.Printf("%-9s %s -> %s (%s)\n", rec.Action, rec.ID, rec.NewID, rec.Name)
+		} else {
+			fmt.Printf("%-9s %s (%s)\n", rec.Action, rec.ID, rec.Name)
+		}
+	}
+	for _, e := range report.Errors {
+		fmt.Println("error    ", e)
+	}
+	fmt.Printf("%d recipe(s), %d image(s), %d error(s)\n", len(report.Recipes), report.Images, len(report.Errors))
+}
+
+func restoreBackup(reader *bufio.Reader) {
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		fmt.Println("Failed to load config:", err)
+		return
+	}
+
+	backups, err := rfp.ListBackups(cfg)
+	if err != nil {
+		fmt.Println("Failed to read backups:", err)
+		return
+	}
+	if len(backups) == 0 {
+		fmt.Println("No backups found in", rfp.BackupDir(cfg))
+		return
+	}
+	for i, b := range backups {
+		fmt.Printf("%d) %s (%d KB)\n", i+1, b.Name, b.Size/1024)
+	}
+
+	fmt.Print("Backup to restore: ")
+	var choice int
+	fmt.Scan(&choice)
 	reader.ReadString('\n')
+	if choice < 1 || choice > len(backups) {
+		fmt.Println("Unknown option")
+		return
+	}
+	name := backups[choice-1].Name
+
+	fmt.Println("Verifying", name, "...")
+	if err := rfp.VerifyBackup(cfg, name); err != nil {
+		fmt.Println("Backup is damaged, not restoring:", err)
+		return
+	}
+
+	fmt.Print("This replaces the current recipes and images. Continue? (y/n): ")
+	answer, _ := reader.ReadString('\n')
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+		fmt.Println("Restore cancelled")
+		return
+	}
+
+	if err := rfp.RestoreBackup(cfg, name); err != nil {
+		fmt.Println("Restore failed:", err)
+		return
+	}
+	fmt.Println("Restored", name, "- the previous directories were kept with a .before-restore suffix")
+}
+
+func reindex() {
+	cfg, err := rfp.LoadConfig()
+	if err != nil {
+		fmt.Println("Failed to load config:", err)
+		return
+	}
+
+	// Reuse the API server's handle if it is running in this process
+	idx := recipeIndex
+	if idx == nil {
+		idx, err = index.Open(cfg)
+		if err != nil {
+			fmt.Println("Failed to open index:", err)
+			return
+		}
+		defer idx.Close()
+	}
+
+	count, err := idx.Rebuild()
+	if err != nil {
+		fmt.Println("Failed to rebuild index:", err)
+		return
+	}
+	fmt.Printf("Indexed %d recipe(s) into %s\n", count, index.IndexPath(cfg))
+}
+
+func ScrapeAS() {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Print("URL, or path to a saved HTML page: ")
+	target, _ := reader.ReadString('\n')
+	target = strings.TrimSpace(target)
+
+	baseURL := ""
+	if !isURL(target) {
+		fmt.Print("Page URL for resolving links (optional): ")
+		baseURL, _ = reader.ReadString('\n')
+		baseURL = strings.TrimSpace(baseURL)
+	}
+	scrapeAndSave(reader, target, baseURL)
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
 
-	recipe, err := ars.ScrapeAllRecipes(url, config.DefaultImagePath)
+// scrapeAndSave scrapes a URL, or an HTML file when target is a path, prints
+// the recipe and saves it. Guessed recipes are only saved if confirmed.
+func scrapeAndSave(reader *bufio.Reader, target, baseURL string) {
+	config, err := rfp.LoadConfig()
 	if err != nil {
-		log.Fatal(err)
+		fmt.Println("Failed to load config:", err)
+		return
 	}
+	ars.Configure(config)
 
+	var result *ars.ScrapeResult
+	source := target
+	if isURL(target) {
+		result, err = ars.ScrapeRecipe(context.Background(), target, config.DefaultImagePath)
+	} else {
+		html, readErr := os.ReadFile(target)
+		if readErr != nil {
+			fmt.Println("Failed to read HTML file:", readErr)
+			return
+		}
+		if baseURL != "" {
+			source = baseURL
+		}
+		result, err = ars.ScrapeRecipeHTML(context.Background(), html, baseURL, config.DefaultImagePath)
+	}
+	if err != nil {
+		fmt.Println("Failed to scrape recipe:", err)
+		return
+	}
+	recipe := result.Recipe
+
+	fmt.Printf("Scraped with %s (confidence %.0f%%)\n", result.Scraper, result.Confidence*100)
+	fmt.Println("Name:", recipe.Name)
 	fmt.Println("Image Path:", recipe.ImagePath)
-	fmt.Println("Prep Time:", recipe.CoreProps["prep time"])
-	fmt.Println("Cook Time:", recipe.CoreProps["cook time"])
-	fmt.Println("Additional Time:", recipe.CoreProps["additional time"])
-	fmt.Println("Total Time:", recipe.CoreProps["total time"])
-	fmt.Println("Servings:", recipe.CoreProps["servings"])
+	fmt.Println("Prep Time:", timeText(recipe.Prop("prep time"), 0))
+	fmt.Println("Cook Time:", timeText(recipe.Prop("cook time"), 0))
+	fmt.Println("Additional Time:", timeText(recipe.Prop("additional time"), 0))
+	fmt.Println("Total Time:", timeText(recipe.Prop("total time"), recipe.Times().Total))
+	fmt.Println("Servings:", recipe.Prop("servings"))
 
 	fmt.Println("\nIngredients:")
 	for _, ing := range recipe.Ingredients {
@@ -209,5 +509,21 @@ func ScrapeAS() {
 		fmt.Printf("%d) %s\n", i+1, step)
 	}
 
-	rfp.WriteRecipe(config.DefaultRecipePath, recipe.Name, *recipe)
+	// A guessed recipe is only saved once someone has looked at it
+	if result.Confidence < 1 {
+		fmt.Print("\nThis recipe was guessed from an unstructured page. Save it? (y/n): ")
+		answer, _ := reader.ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			fmt.Println("Recipe not saved")
+			return
+		}
+	}
+
+	if err := rfp.WriteRecipe(config.DefaultRecipePath, recipe.Name, *recipe); err != nil {
+		fmt.Println("Error writing recipe:", err)
+		return
+	}
+	if err := rfp.RecordChange(config, fmt.Sprintf("Scrape recipe %q from %s", recipe.Name, source), rfp.RecipeID(recipe.Name)); err != nil {
+		fmt.Println("Failed to commit recipe:", err)
+	}
 }
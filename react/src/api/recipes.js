@@ -2,23 +2,71 @@ import axios from 'axios';
 
 const BASE_URL = '/api'; // Go server API
 
+// Last ETag seen per recipe ID, sent back as If-Match so stale edits get a 412
+const etags = {};
+
+function ifMatch(id) {
+  return etags[id] ? { headers: { 'If-Match': etags[id] } } : {};
+}
+
+// imageUrl returns the URL for a recipe's ImageURL, resized to size (thumbnail,
+// medium, large) when the server holds the image; external URLs pass through
+export function imageUrl(recipeImageUrl, size) {
+  if (!recipeImageUrl || !recipeImageUrl.startsWith('/images/')) return recipeImageUrl;
+  return `${BASE_URL}${recipeImageUrl}` + (size ? `?size=${size}` : '');
+}
+
+// fetchRecipes returns every recipe's id and name, following the pages of
+// GET /recipes until the last one
 export async function fetchRecipes() {
   try {
-    const res = await axios.get(`${BASE_URL}/recipes`);
-    const data = res.data;
-    // Always return an array
-    if (Array.isArray(data)) return data;
-    if (Array.isArray(data.recipes)) return data.recipes;
-    return [];
+    const recipes = [];
+    let cursor = null;
+    do {
+      const res = await axios.get(`${BASE_URL}/recipes`, {
+        params: { limit: 500, ...(cursor && { cursor }) },
+      });
+      recipes.push(...(Array.isArray(res.data.recipes) ? res.data.recipes : []));
+      cursor = res.data.next_cursor;
+    } while (cursor);
+    return recipes;
   } catch (err) {
     console.error('Failed to fetch recipes:', err);
     return [];
   }
 }
 
+// searchRecipes returns { results, didYouMean } for q. Each result carries HTML
+// highlights (matches wrapped in <mark>, everything else escaped by the server);
+// didYouMean is set when q found nothing and a corrected query was used instead
+export async function searchRecipes(q) {
+  try {
+    const res = await axios.get(`${BASE_URL}/search`, { params: { q } });
+    return {
+      results: Array.isArray(res.data.results) ? res.data.results : [],
+      didYouMean: res.data.did_you_mean || '',
+    };
+  } catch (err) {
+    console.error('Failed to search recipes:', err);
+    throw err;
+  }
+}
+
+// suggestRecipes returns recipe names for autocomplete, tolerating typos
+export async function suggestRecipes(prefix) {
+  try {
+    const res = await axios.get(`${BASE_URL}/suggest`, { params: { prefix } });
+    return Array.isArray(res.data) ? res.data : [];
+  } catch (err) {
+    console.error('Failed to fetch suggestions:', err);
+    return [];
+  }
+}
+
 export async function fetchRecipe(id) {
   try {
     const res = await axios.get(`${BASE_URL}/recipes/${id}`);
+    if (res.headers.etag) etags[id] = res.headers.etag;
     return res.data;
   } catch (err) {
     console.error(`Failed to fetch recipe ${id}:`, err);
@@ -38,7 +86,8 @@ export async function createRecipe(recipe) {
 
 export async function updateRecipe(id, recipe) {
   try {
-    const res = await axios.put(`${BASE_URL}/recipes/${id}`, recipe);
+    const res = await axios.put(`${BASE_URL}/recipes/${id}`, recipe, ifMatch(id));
+    if (res.headers.etag) etags[id] = res.headers.etag;
     return res.data;
   } catch (err) {
     console.error(`Failed to update recipe ${id}:`, err);
@@ -48,7 +97,8 @@ export async function updateRecipe(id, recipe) {
 
 export async function deleteRecipe(id) {
   try {
-    const res = await axios.delete(`${BASE_URL}/recipes/${id}`);
+    const res = await axios.delete(`${BASE_URL}/recipes/${id}`, ifMatch(id));
+    delete etags[id];
     return res.data;
   } catch (err) {
     console.error(`Failed to delete recipe ${id}:`, err);
@@ -65,3 +115,100 @@ export async function scrapeRecipe(url) {
     throw err;
   }
 }
+
+// scrapeRecipeHTML scrapes a saved page, given as pasted HTML text or an
+// uploaded .html File. url is optional: where the page came from, used to
+// resolve its image link.
+export async function scrapeRecipeHTML(html, url) {
+  try {
+    let res;
+    if (html instanceof File) {
+      const form = new FormData();
+      form.append('file', html);
+      if (url) form.append('url', url);
+      res = await axios.post('/api/scrape', form);
+    } else {
+      res = await axios.post('/api/scrape', { html, url });
+    }
+    return res.data;
+  } catch (err) {
+    console.error('Failed to scrape recipe HTML:', err);
+    throw err;
+  }
+}
+
+// startScrapeJob queues a scrape in the background and returns the job. page
+// is optional: pasted HTML text or an uploaded .html File to scrape instead of
+// fetching url.
+export async function startScrapeJob(url, page) {
+  try {
+    let res;
+    if (page instanceof File) {
+      const form = new FormData();
+      form.append('file', page);
+      if (url) form.append('url', url);
+      res = await axios.post(`${BASE_URL}/scrape/jobs`, form);
+    } else {
+      res = await axios.post(`${BASE_URL}/scrape/jobs`, { url, ...(page && { html: page }) });
+    }
+    return res.data;
+  } catch (err) {
+    console.error('Failed to queue scrape:', err);
+    throw err;
+  }
+}
+
+export async function fetchScrapeJob(jobId) {
+  try {
+    const res = await axios.get(`${BASE_URL}/scrape/jobs/${jobId}`);
+    return res.data;
+  } catch (err) {
+    console.error(`Failed to fetch scrape job ${jobId}:`, err);
+    throw err;
+  }
+}
+
+export async function cancelScrapeJob(jobId) {
+  try {
+    const res = await axios.delete(`${BASE_URL}/scrape/jobs/${jobId}`);
+    return res.data;
+  } catch (err) {
+    console.error(`Failed to cancel scrape job ${jobId}:`, err);
+    throw err;
+  }
+}
+
+// waitForScrapeJob polls a job until it finishes, calling onUpdate with each
+// new state, and returns the finished job
+export async function waitForScrapeJob(jobId, onUpdate, interval = 1000) {
+  for (;;) {
+    const job = await fetchScrapeJob(jobId);
+    if (onUpdate) onUpdate(job);
+    if (!['queued', 'running'].includes(job.status)) return job;
+    await new Promise(resolve => setTimeout(resolve, interval));
+  }
+}
+
+export async function uploadRecipeImage(id, file) {
+  try {
+    const form = new FormData();
+    form.append('image', file);
+    const res = await axios.post(`${BASE_URL}/recipes/${id}/image`, form, ifMatch(id));
+    if (res.headers.etag) etags[id] = res.headers.etag;
+    return res.data;
+  } catch (err) {
+    console.error(`Failed to upload image for recipe ${id}:`, err);
+    throw err;
+  }
+}
+
+export async function deleteRecipeImage(id) {
+  try {
+    const res = await axios.delete(`${BASE_URL}/recipes/${id}/image`, ifMatch(id));
+    if (res.headers.etag) etags[id] = res.headers.etag;
+    return res.data;
+  } catch (err) {
+    console.error(`Failed to remove image for recipe ${id}:`, err);
+    throw err;
+  }
+}
@@ -1,5 +1,5 @@
 import React, { useEffect, useState } from 'react';
-import { fetchRecipe } from '../api/recipes';
+import { fetchRecipe, imageUrl } from '../api/recipes';
 import { useParams } from 'react-router-dom';
 import './RecipeDetail.css';
 
@@ -37,10 +37,12 @@ export default function RecipeDetail() {
       </header>
 
       {/* Recipe Image */}
-      {recipe.ImagePath && (
+      {recipe.ImageURL && (
         <figure className="recipe-image-container">
           <img
-            src={recipe.ImagePath}
+            src={imageUrl(recipe.ImageURL, 'large')}
+            srcSet={`${imageUrl(recipe.ImageURL, 'medium')} 600w, ${imageUrl(recipe.ImageURL, 'large')} 1200w`}
+            sizes="(max-width: 600px) 100vw, 1200px"
             alt={recipe.Name}
             className="recipe-image"
           />
@@ -1,5 +1,5 @@
 import React, { useState, useEffect } from 'react';
-import { createRecipe } from '../api/recipes';
+import { createRecipe, uploadRecipeImage } from '../api/recipes';
 import { useNavigate } from 'react-router-dom';
 import './RecipeForm.css';
 
@@ -8,6 +8,7 @@ export default function RecipeForm() {
   const [ingredients, setIngredients] = useState(['']);
   const [steps, setSteps] = useState(['']);
   const [customProps, setCustomProps] = useState([{ key: '', value: '' }]);
+  const [image, setImage] = useState(null);
   const navigate = useNavigate();
 
   // Auto-resize textareas
@@ -30,12 +31,19 @@ export default function RecipeForm() {
       }
     });
 
-    await createRecipe({
+    const created = await createRecipe({
       Name: name,
       Ingredients: ingredients.filter(Boolean),
       Steps: steps.filter(Boolean),
       CoreProps: coreProps
     });
+    if (image) {
+      try {
+        await uploadRecipeImage(created.id, image);
+      } catch (err) {
+        alert('Recipe saved, but the image upload failed');
+      }
+    }
     navigate('/');
   };
 
@@ -90,6 +98,16 @@ export default function RecipeForm() {
             />
           </div>
 
+          <div className="info-row">
+            <label className="info-label">Image</label>
+            <input
+              type="file"
+              className="info-value"
+              accept="image/jpeg,image/png,image/gif,image/webp"
+              onChange={e => setImage(e.target.files[0] || null)}
+            />
+          </div>
+
           {/* Custom Properties */}
           {customProps.map((prop, i) => (
             <div key={i} className="info-row custom-prop-row">
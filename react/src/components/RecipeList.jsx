@@ -1,11 +1,15 @@
 import React, { useState, useEffect } from 'react';
-import { fetchRecipes, deleteRecipe } from '../api/recipes';
+import { fetchRecipes, deleteRecipe, searchRecipes, suggestRecipes } from '../api/recipes';
 import { Link } from 'react-router-dom';
 import './RecipeList.css';
 
 export default function RecipeList() {
   const [recipes, setRecipes] = useState([]);
   const [loading, setLoading] = useState(true);
+  const [query, setQuery] = useState('');
+  const [results, setResults] = useState(null);
+  const [didYouMean, setDidYouMean] = useState('');
+  const [suggestions, setSuggestions] = useState([]);
 
   useEffect(() => {
     const loadRecipes = async () => {
@@ -29,10 +33,34 @@ export default function RecipeList() {
     loadRecipes();
   }, []);
 
+  // Search as the user types, debounced; an empty box shows the full list again
+  useEffect(() => {
+    if (!query.trim()) {
+      setResults(null);
+      setDidYouMean('');
+      setSuggestions([]);
+      return;
+    }
+    // Suggestions are cheap, so they follow every keystroke
+    suggestRecipes(query).then(setSuggestions);
+    const timer = setTimeout(async () => {
+      try {
+        const found = await searchRecipes(query);
+        setResults(found.results);
+        setDidYouMean(found.didYouMean);
+      } catch (err) {
+        setResults([]);
+        setDidYouMean('');
+      }
+    }, 250);
+    return () => clearTimeout(timer);
+  }, [query]);
+
   const handleDelete = async (id) => {
     try {
       await deleteRecipe(id);
       setRecipes(prev => prev.filter(r => r.id !== id));
+      setResults(prev => prev && prev.filter(r => r.id !== id));
     } catch (err) {
       console.error('Failed to delete recipe:', err);
       alert('Failed to delete recipe. Check console for details.');
@@ -41,21 +69,55 @@ export default function RecipeList() {
 
   if (loading) return <p>Loading recipes...</p>;
 
-  if (!recipes.length) return (
+  const shown = results ?? recipes;
+
+  const searchBox = (
+    <>
+      <input
+        type="search"
+        className="recipe-search"
+        placeholder='Search recipes, e.g. chicken "brown sugar"'
+        value={query}
+        onChange={e => setQuery(e.target.value)}
+        list="recipe-suggestions"
+      />
+      <datalist id="recipe-suggestions">
+        {suggestions.map(s => <option key={s.id} value={s.name} />)}
+      </datalist>
+      {didYouMean && (
+        <p className="recipe-did-you-mean">
+          No results for “{query}”. Showing results for{' '}
+          <button type="button" onClick={() => setQuery(didYouMean)}>{didYouMean}</button>
+        </p>
+      )}
+    </>
+  );
+
+  if (!shown.length) return (
     <div className="recipe-list-container">
       <h1>Recipes</h1>
-      <p>No recipes found.</p>
+      {searchBox}
+      <p>{results ? 'No matching recipes.' : 'No recipes found.'}</p>
     </div>
   );
 
   return (
     <div className="recipe-list-container">
       <h1>Recipes</h1>
+      {searchBox}
       <ul className="recipe-list">
-        {recipes.map(r => (
+        {shown.map(r => (
           <li key={r.id} className="recipe-item">
             <Link to={`/recipe/${r.id}`} className="recipe-link">
-              <span className="recipe-name">{r.name}</span>
+              {/* Highlights are escaped by the server apart from the <mark> tags */}
+              {r.highlights?.name
+                ? <span className="recipe-name" dangerouslySetInnerHTML={{ __html: r.highlights.name }} />
+                : <span className="recipe-name">{r.name}</span>}
+              {r.highlights && ['ingredients', 'steps', 'props']
+                .filter(field => r.highlights[field])
+                .map(field => (
+                  <span key={field} className="recipe-snippet" dangerouslySetInnerHTML={{ __html: r.highlights[field] }} />
+                ))}
             </Link>
             <button
               onClick={() => handleDelete(r.id)}
@@ -1,5 +1,5 @@
 import React, { useState, useEffect } from 'react';
-import { scrapeRecipe, createRecipe, updateRecipe } from '../api/recipes';
+import { startScrapeJob, waitForScrapeJob, cancelScrapeJob, createRecipe, updateRecipe } from '../api/recipes';
 import { useNavigate, useParams } from 'react-router-dom';
 import './ScrapeRecipe.css';
 
@@ -8,9 +8,16 @@ export default function ScrapeRecipe() {
   const navigate = useNavigate();
 
   const [url, setUrl] = useState('');
+  // A saved page to scrape instead of fetching url: pasted HTML or an .html file
+  const [html, setHtml] = useState('');
+  const [htmlFile, setHtmlFile] = useState(null);
   const [recipe, setRecipe] = useState(null);
   const [loading, setLoading] = useState(false);
+  // The background scrape job while one is running
+  const [job, setJob] = useState(null);
   const [customProps, setCustomProps] = useState([{ key: '', value: '' }]);
+  // How sure the server is about the scrape; below 1 the recipe was guessed
+  const [confidence, setConfidence] = useState(1);
 
   // Auto-resize textareas
   useEffect(() => {
@@ -22,11 +29,21 @@ export default function ScrapeRecipe() {
   }, [recipe]);
 
   const handleScrape = async () => {
-    if (!url) return;
+    const page = htmlFile || html.trim();
+    if (!url && !page) return;
     setLoading(true);
     try {
-      const scraped = await scrapeRecipe(url, false);
+      const queued = await startScrapeJob(url, page);
+      setJob(queued);
+      const finished = await waitForScrapeJob(queued.id, setJob);
+      if (finished.status === 'cancelled') return;
+      if (finished.status !== 'done') {
+        alert(`Failed to scrape recipe: ${finished.error}`);
+        return;
+      }
+      const { Scraper, Confidence, ...scraped } = finished.result;
       setRecipe(scraped);
+      setConfidence(Confidence ?? 1);
 
       // Initialize custom props from CoreProps if they exist
       if (scraped.CoreProps && Object.keys(scraped.CoreProps).length > 0) {
@@ -38,9 +55,26 @@ export default function ScrapeRecipe() {
       console.error(err);
     } finally {
       setLoading(false);
+      setJob(null);
     }
   };
 
+  const handleCancel = async () => {
+    if (!job) return;
+    try {
+      await cancelScrapeJob(job.id);
+    } catch (err) {
+      console.error(err);
+    }
+  };
+
+  const jobStatus = () => {
+    if (!job) return 'Scraping...';
+    if (job.status === 'queued') return `Waiting in queue (${job.position})...`;
+    if (job.progress === 'cancelling') return 'Cancelling...';
+    return 'Scraping...';
+  };
+
   const handleSave = async () => {
     if (!recipe) return;
 
@@ -73,7 +107,7 @@ export default function ScrapeRecipe() {
   const updateField = (field, value, index = null) => {
     if (!recipe) return;
     const copy = { ...recipe };
-    if (field === 'Name' || field === 'ImagePath') {
+    if (field === 'Name' || field === 'ImageURL') {
       copy[field] = value;
     } else if (field === 'Ingredients') {
       const ing = [...copy.Ingredients];
@@ -133,7 +167,10 @@ export default function ScrapeRecipe() {
       {!recipe ? (
         <div className="scrape-form">
           <h1>{id ? 'Edit Recipe' : 'Scrape Recipe'}</h1>
-          <p className="scrape-description">Enter a recipe URL to automatically extract recipe information</p>
+          <p className="scrape-description">
+            Enter a recipe URL to automatically extract recipe information, or paste or upload a saved
+            page (the URL is then optional and only used to find the page's image)
+          </p>
 
           <div className="scrape-input-section">
             <div className="info-row">
@@ -141,25 +178,59 @@ export default function ScrapeRecipe() {
               <input
                 type="text"
                 className="info-value"
-                placeholder="https://www.allrecipes.com/recipe/..."
+                placeholder="https://www.example.com/recipe/..."
                 value={url}
                 onChange={e => setUrl(e.target.value)}
               />
             </div>
 
+            <div className="info-row">
+              <label className="info-label">Page HTML</label>
+              <textarea
+                className="info-value"
+                placeholder="Paste the page source (optional)"
+                rows={4}
+                value={html}
+                onChange={e => setHtml(e.target.value)}
+                disabled={!!htmlFile}
+              />
+            </div>
+
+            <div className="info-row">
+              <label className="info-label">Saved page</label>
+              <input
+                type="file"
+                className="info-value"
+                accept=".html,.htm,text/html"
+                onChange={e => setHtmlFile(e.target.files[0] || null)}
+              />
+            </div>
+
             <button
               onClick={handleScrape}
               disabled={loading}
               className="primary submit-button"
             >
-              {loading ? 'Scraping...' : 'Scrape Recipe'}
+              {loading ? jobStatus() : 'Scrape Recipe'}
             </button>
+            {job && (
+              <button type="button" onClick={handleCancel} className="submit-button">
+                Cancel
+              </button>
+            )}
           </div>
         </div>
       ) : (
         <form onSubmit={e => { e.preventDefault(); handleSave(); }} className="recipe-form">
           <h1>{id ? 'Edit Recipe' : 'Scraped Recipe'}</h1>
 
+          {confidence < 1 && (
+            <p className="scrape-review-note">
+              This page had no recipe data, so these details were guessed
+              ({Math.round(confidence * 100)}% confidence). Please check them before saving.
+            </p>
+          )}
+
           {/* Recipe Information Section */}
           <section className="recipe-info-section">
             <h3>Recipe Information</h3>
@@ -180,8 +251,8 @@ export default function ScrapeRecipe() {
               <input
                 className="info-value"
                 placeholder="Enter image URL (optional)"
-                value={recipe.ImagePath || ''}
-                onChange={e => updateField('ImagePath', e.target.value)}
+                value={recipe.ImageURL || ''}
+                onChange={e => updateField('ImageURL', e.target.value)}
               />
             </div>
 
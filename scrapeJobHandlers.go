@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	rfp "github.com/CaptSniper/RecipeServer/RFP"
+	ars "github.com/CaptSniper/RecipeServer/webScraper"
+	"github.com/gorilla/mux"
+)
+
+// Scrape jobs run the same scrape as POST /scrape in the background, so the
+// client gets an ID straight away and polls for the result. A fixed number of
+// workers take jobs in the order they were queued. The queue is written to
+// disk on every change; after a restart, queued jobs wait again and jobs
+// that were running start over. Uploaded HTML is kept in a file per job
+// rather than in the queue file, which stays small enough to rewrite often.
+
+// Job states
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+const (
+	defaultScrapeWorkers = 2
+	maxQueuedScrapeJobs  = 100
+	scrapeJobRetention   = 24 * time.Hour // finished jobs are forgotten after this
+)
+
+var (
+	errScrapeQueueFull  = errors.New("scrape queue is full")
+	errScrapeJobMissing = errors.New("scrape job not found")
+	errScrapeJobDone    = errors.New("scrape job has already finished")
+)
+
+// ScrapeJob is one queued scrape
+type ScrapeJob struct {
+	ID       string            `json:"id"`
+	Status   string            `json:"status"`
+	Progress string            `json:"progress,omitempty"` // what a running job is doing
+	Position int               `json:"position,omitempty"` // place in the queue, 1 being next
+	URL      string            `json:"url,omitempty"`
+	BaseURL  string            `json:"base_url,omitempty"`
+	HasHTML  bool              `json:"has_html,omitempty"` // scrapes uploaded HTML, kept in the job's HTML file until it finishes
+	Save     bool              `json:"save"`
+	Result   *ars.ScrapeResult `json:"result,omitempty"`
+	RecipeID string            `json:"recipe_id,omitempty"` // set once a job with Save has saved its recipe
+	Error    string            `json:"error,omitempty"`
+	Created  time.Time         `json:"created"`
+	Started  *time.Time        `json:"started,omitempty"`
+	Finished *time.Time        `json:"finished,omitempty"`
+}
+
+func (j *ScrapeJob) finished() bool {
+	return j.Status == jobDone || j.Status == jobFailed || j.Status == jobCancelled
+}
+
+// scrapeQueue holds every job the server knows about
+type scrapeQueue struct {
+	mu      sync.Mutex
+	ready   *sync.Cond // signalled when a job is queued
+	path    string
+	htmlDir string
+	jobs    map[string]*ScrapeJob
+	order   []string                      // job IDs, oldest first
+	cancels map[string]context.CancelFunc // for running jobs
+	version int                           // bumped on every change, so an older snapshot is never written over a newer one
+
+	saveMu  sync.Mutex // held while writing the queue file, outside mu
+	written int        // version of the last queue file written
+}
+
+var scrapeJobs *scrapeQueue
+
+// scrapeJobsPath is where the queue is kept between restarts
+func scrapeJobsPath() string {
+	return filepath.Join(".config", "scrape_jobs.json")
+}
+
+// scrapeJobsHTMLDir holds the HTML uploaded for each waiting job
+func scrapeJobsHTMLDir() string {
+	return filepath.Join(".config", "scrape_jobs")
+}
+
+// startScrapeQueue loads the saved queue and starts the workers
+func startScrapeQueue(cfg *rfp.Config) (*scrapeQueue, error) {
+	q := &scrapeQueue{path: scrapeJobsPath(), htmlDir: scrapeJobsHTMLDir(), jobs: map[string]*ScrapeJob{}, cancels: map[string]context.CancelFunc{}}
+	q.ready = sync.NewCond(&q.mu)
+
+	data, err := os.ReadFile(q.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var saved []*ScrapeJob
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", q.path, err)
+		}
+		for _, job := range saved {
+			if job.Status == jobRunning {
+				job.Status, job.Progress, job.Started = jobQueued, "", nil
+			}
+			q.jobs[job.ID] = job
+			q.order = append(q.order, job.ID)
+		}
+	}
+	if err := os.MkdirAll(q.htmlDir, 0755); err != nil {
+		return nil, err
+	}
+	q.removeStaleHTML()
+	if err := q.save(); err != nil {
+		return nil, err
+	}
+
+	workers := cfg.ScrapeWorkers
+	if workers <= 0 {
+		workers = defaultScrapeWorkers
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q, nil
+}
+
+// Add queues a scrape
+func (q *scrapeQueue) Add(req ScrapeRequest) (ScrapeJob, error) {
+	id, err := newJobID()
+	if err != nil {
+		return ScrapeJob{}, err
+	}
+	job := &ScrapeJob{ID: id, Status: jobQueued, URL: req.URL, BaseURL: req.BaseURL, HasHTML: req.HTML != "", Save: req.Save, Created: time.Now().UTC()}
+
+	q.mu.Lock()
+	full := q.fullLocked()
+	q.mu.Unlock()
+	if full {
+		return ScrapeJob{}, errScrapeQueueFull
+	}
+
+	// Written before the job is queued, so a worker never finds it missing
+	if job.HasHTML {
+		if err := writeFileAtomic(q.htmlPath(id), []byte(req.HTML)); err != nil {
+			return ScrapeJob{}, fmt.Errorf("failed to save HTML: %v", err)
+		}
+	}
+
+	q.mu.Lock()
+	if q.fullLocked() { // filled up while the HTML was written
+		q.mu.Unlock()
+		q.removeHTML(*job)
+		return ScrapeJob{}, errScrapeQueueFull
+	}
+	q.jobs[id] = job
+	q.order = append(q.order, id)
+	q.version++
+	view := q.viewLocked(job)
+	q.ready.Signal()
+	q.mu.Unlock()
+
+	q.saveOrLog()
+	return view, nil
+}
+
+func (q *scrapeQueue) fullLocked() bool {
+	queued := 0
+	for _, job := range q.jobs {
+		if job.Status == jobQueued {
+			queued++
+		}
+	}
+	return queued >= maxQueuedScrapeJobs
+}
+
+// Get returns a job by ID
+func (q *scrapeQueue) Get(id string) (ScrapeJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return ScrapeJob{}, false
+	}
+	return q.viewLocked(job), true
+}
+
+// List returns every job, newest first
+func (q *scrapeQueue) List() []ScrapeJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]ScrapeJob, 0, len(q.order))
+	for i := len(q.order) - 1; i >= 0; i-- {
+		jobs = append(jobs, q.viewLocked(q.jobs[q.order[i]]))
+	}
+	return jobs
+}
+
+// Cancel stops a queued or running job
+func (q *scrapeQueue) Cancel(id string) (ScrapeJob, error) {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if !ok {
+		q.mu.Unlock()
+		return ScrapeJob{}, errScrapeJobMissing
+	}
+	switch job.Status {
+	case jobQueued:
+		q.finishLocked(job, jobCancelled, nil, "cancelled before it started")
+	case jobRunning:
+		// The worker marks the job cancelled once the scrape returns
+		job.Progress = "cancelling"
+		q.cancels[id]()
+	default:
+		view := q.viewLocked(job)
+		q.mu.Unlock()
+		return view, errScrapeJobDone
+	}
+	q.version++
+	view := q.viewLocked(job)
+	q.mu.Unlock()
+
+	if view.Status == jobCancelled {
+		q.removeHTML(view)
+	}
+	q.saveOrLog()
+	return view, nil
+}
+
+// work runs jobs one at a time until the server stops
+func (q *scrapeQueue) work() {
+	for {
+		q.mu.Lock()
+		job := q.nextLocked()
+		for job == nil {
+			q.ready.Wait()
+			job = q.nextLocked()
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		now := time.Now().UTC()
+		job.Status, job.Progress, job.Started = jobRunning, "scraping", &now
+		q.cancels[job.ID] = cancel
+		q.version++
+		view := q.viewLocked(job)
+		q.mu.Unlock()
+		q.saveOrLog()
+
+		result, err := q.run(ctx, view)
+
+		q.mu.Lock()
+		switch {
+		case err == nil:
+			q.finishLocked(job, jobDone, result, "")
+			if job.Save {
+				job.RecipeID = rfp.RecipeID(result.Recipe.Name)
+			}
+		case ctx.Err() != nil:
+			q.finishLocked(job, jobCancelled, nil, "cancelled")
+		default:
+			q.finishLocked(job, jobFailed, nil, err.Error())
+		}
+		delete(q.cancels, job.ID)
+		cancel()
+		q.version++
+		q.mu.Unlock()
+
+		q.removeHTML(view)
+		q.saveOrLog()
+	}
+}
+
+// run scrapes and, if asked, saves one job's recipe
+func (q *scrapeQueue) run(ctx context.Context, job ScrapeJob) (*ars.ScrapeResult, error) {
+	req := ScrapeRequest{URL: job.URL, BaseURL: job.BaseURL, Save: job.Save}
+	if job.HasHTML {
+		html, err := os.ReadFile(q.htmlPath(job.ID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read uploaded HTML: %v", err)
+		}
+		req.HTML = string(html)
+	}
+
+	config, err := rfp.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %v", err)
+	}
+	result, err := runScrape(ctx, config, req)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err() // cancelled after the scrape; don't save
+	}
+	if !req.Save {
+		return result, nil
+	}
+	q.setProgress(job.ID, "saving")
+	if err := saveScraped(config, req, result); err != nil {
+		return nil, fmt.Errorf("failed to save recipe: %v", err)
+	}
+	return result, nil
+}
+
+func (q *scrapeQueue) setProgress(id, progress string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job, ok := q.jobs[id]; ok && job.Status == jobRunning {
+		job.Progress = progress
+		q.version++
+	}
+}
+
+// nextLocked returns the oldest queued job, or nil
+func (q *scrapeQueue) nextLocked() *ScrapeJob {
+	for _, id := range q.order {
+		if job := q.jobs[id]; job.Status == jobQueued {
+			return job
+		}
+	}
+	return nil
+}
+
+func (q *scrapeQueue) finishLocked(job *ScrapeJob, status string, result *ars.ScrapeResult, errText string) {
+	now := time.Now().UTC()
+	job.Status, job.Progress, job.Result, job.Error, job.Finished = status, "", result, errText, &now
+}
+
+// viewLocked copies a job for the API, with its place in the queue
+func (q *scrapeQueue) viewLocked(job *ScrapeJob) ScrapeJob {
+	view := *job
+	if job.Status == jobQueued {
+		for _, id := range q.order {
+			if q.jobs[id].Status == jobQueued {
+				view.Position++
+			}
+			if id == job.ID {
+				break
+			}
+		}
+	}
+	return view
+}
+
+func (q *scrapeQueue) htmlPath(id string) string {
+	return filepath.Join(q.htmlDir, id+".html")
+}
+
+// removeHTML deletes a job's HTML file once the job no longer needs it
+func (q *scrapeQueue) removeHTML(job ScrapeJob) {
+	if job.HasHTML {
+		if err := os.Remove(q.htmlPath(job.ID)); err != nil && !os.IsNotExist(err) {
+			log.Println("Failed to remove scrape job HTML:", err)
+		}
+	}
+}
+
+// removeStaleHTML deletes HTML files left behind by jobs that have finished or
+// are no longer in the queue, e.g. after a crash
+func (q *scrapeQueue) removeStaleHTML() {
+	files, err := os.ReadDir(q.htmlDir)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		id := strings.TrimSuffix(file.Name(), ".html")
+		if job, ok := q.jobs[id]; ok && job.HasHTML && !job.finished() {
+			continue
+		}
+		os.Remove(filepath.Join(q.htmlDir, file.Name()))
+	}
+}
+
+// save drops expired jobs and writes the queue. The snapshot is taken under
+// mu but written outside it, so polling clients never wait on the disk.
+func (q *scrapeQueue) save() error {
+	q.mu.Lock()
+	cutoff := time.Now().Add(-scrapeJobRetention)
+	kept := q.order[:0]
+	saved := make([]*ScrapeJob, 0, len(q.order))
+	for _, id := range q.order {
+		job := q.jobs[id]
+		if job.finished() && job.Finished != nil && job.Finished.Before(cutoff) {
+			delete(q.jobs, id)
+			continue
+		}
+		kept = append(kept, id)
+		saved = append(saved, job)
+	}
+	q.order = kept
+	version := q.version
+	data, err := json.MarshalIndent(saved, "", "  ")
+	q.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal scrape jobs: %v", err)
+	}
+
+	q.saveMu.Lock()
+	defer q.saveMu.Unlock()
+	if version < q.written {
+		return nil // a newer snapshot is already on disk
+	}
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(q.path, data); err != nil {
+		return fmt.Errorf("failed to write scrape jobs: %v", err)
+	}
+	q.written = version
+	return nil
+}
+
+func (q *scrapeQueue) saveOrLog() {
+	if err := q.save(); err != nil {
+		log.Println("Failed to save scrape jobs:", err)
+	}
+}
+
+// writeFileAtomic writes through a temp file so a crash never leaves path half written
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// createScrapeJobHandler – queues a scrape and returns the job straight away.
+// Takes the same JSON or multipart body as POST /scrape.
+func createScrapeJobHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := readScrapeRequest(w, r)
+	if err != nil {
+		http.Error(w, "Invalid scrape request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	job, err := scrapeJobs.Add(req)
+	if errors.Is(err, errScrapeQueueFull) {
+		http.Error(w, "Scrape queue is full, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to queue scrape: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/scrape/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// listScrapeJobsHandler – lists queued, running and recently finished jobs, newest first
+func listScrapeJobsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scrapeJobs.List())
+}
+
+// getScrapeJobHandler – reports a job's status, and its result once done
+func getScrapeJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := scrapeJobs.Get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Scrape job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// cancelScrapeJobHandler – cancels a queued or running job
+func cancelScrapeJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, err := scrapeJobs.Cancel(mux.Vars(r)["id"])
+	if errors.Is(err, errScrapeJobMissing) {
+		http.Error(w, "Scrape job not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errScrapeJobDone) {
+		http.Error(w, "Scrape job has already finished", http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -50,6 +50,12 @@ func StartWebServer() {
 		proxy.ServeHTTP(w, r)
 	})
 
+	// Recipe JSON links images as /images/{name}; serve them from the API here too
+	http.HandleFunc("/images/", func(w http.ResponseWriter, r *http.Request) {
+		r.Host = apiURL.Host
+		proxy.ServeHTTP(w, r)
+	})
+
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		path := strings.TrimPrefix(r.URL.Path, "/")
 